@@ -0,0 +1,157 @@
+package brightness
+
+import (
+	"context"
+	"errors"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// AlarmCheckInterval is the maximum sleep of Alarm.Wait.
+// The clock is checked again after it, so the alarm is not delayed
+// by the suspend while waiting for a long time.
+var AlarmCheckInterval = time.Minute
+
+// Alarm raises the brightness slowly from Min() to the Target like the sunrise,
+// the ramp ends at the time At.
+type Alarm struct {
+	At     time.Time
+	Ramp   time.Duration
+	Target uint
+
+	// SystemClock if nil
+	Clock Clock
+}
+
+// ParseAlarmTime returns the next "HH:MM" after now in the location of now.
+func ParseAlarmTime(now time.Time, s string) (time.Time, error) {
+	fields := strings.Split(s, ":")
+	if len(fields) != 2 {
+		return time.Time{}, errors.New("invalid alarm time " + s)
+	}
+	hour, err := strconv.Atoi(fields[0])
+	if err != nil || hour < 0 || hour > 23 {
+		return time.Time{}, errors.New("invalid alarm time " + s)
+	}
+	min, err := strconv.Atoi(fields[1])
+	if err != nil || min < 0 || min > 59 {
+		return time.Time{}, errors.New("invalid alarm time " + s)
+	}
+	y, m, d := now.Date()
+	at := time.Date(y, m, d, hour, min, 0, 0, now.Location())
+	if !at.After(now) {
+		at = time.Date(y, m, d+1, hour, min, 0, 0, now.Location())
+	}
+	return at, nil
+}
+
+func (a *Alarm) clock() Clock {
+	if a.Clock == nil {
+		return SystemClock
+	}
+	return a.Clock
+}
+
+// Wait waits for the start of the ramp until ctx is done.
+func (a *Alarm) Wait(ctx context.Context) error {
+	clock := a.clock()
+	start := a.At.Add(-a.Ramp)
+	for {
+		now := clock.Now()
+		if !now.Before(start) {
+			return nil
+		}
+		wait := start.Sub(now)
+		if wait > AlarmCheckInterval {
+			wait = AlarmCheckInterval
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-clock.After(wait):
+		}
+	}
+}
+
+// Raise raises the brightness of the device to the Target ending at the time At,
+// by the steps of the raw brightness, perceptually linear by the curve.
+// It sleeps until the next step is due, at least FadeInterval and at most AlarmCheckInterval.
+// The progress is computed from the Clock at every step, so the ramp ends at the time
+// even if it is started late or the machine is suspended while raising.
+// The brightness is never lowered, e.g. the screen brighter than the ramp is kept
+// until the ramp reaches it.
+func (a *Alarm) Raise(ctx context.Context, d *Device) error {
+	if err := a.Check(d); err != nil {
+		return err
+	}
+	last, err := d.Current()
+	if err != nil {
+		return err
+	}
+	clock := a.clock()
+	min, max := d.PercentOf(d.Min()), d.PercentOf(a.Target)
+	for {
+		rest := a.At.Sub(clock.Now())
+		progress := 1.0
+		if rest > 0 && a.Ramp > 0 {
+			progress = math.Max(0, 1-float64(rest)/float64(a.Ramp))
+		}
+		want := d.RawOf(min+(max-min)*progress, RoundNearest)
+		if want > a.Target || rest <= 0 {
+			want = a.Target
+		}
+		if want > last {
+			if err := d.write(want); err != nil {
+				return err
+			}
+			last = want
+		}
+		if rest <= 0 {
+			return nil
+		}
+		if err := sleep(ctx, clock, a.wait(d, last, rest, min, max)); err != nil {
+			return err
+		}
+	}
+}
+
+// the duration until the raw brightness over last is due at the rest of the ramp,
+// in [FadeInterval, AlarmCheckInterval] and up to the rest
+func (a *Alarm) wait(d *Device, last uint, rest time.Duration, min, max float64) time.Duration {
+	wait := rest
+	if last < a.Target && max > min {
+		// RawOf rounds to the nearest, so last+1 is due at the half
+		next := d.Curve().FromRaw((float64(last)+0.5)/float64(d.max)) * 100
+		progress := (next - min) / (max - min)
+		wait = rest - time.Duration((1-progress)*float64(a.Ramp))
+	}
+	if wait < FadeInterval {
+		wait = FadeInterval
+	}
+	if wait > AlarmCheckInterval {
+		wait = AlarmCheckInterval
+	}
+	if wait > rest {
+		wait = rest
+	}
+	return wait
+}
+
+// Check returns the error if the Target can not be set to the device,
+// e.g. before Wait for the long time.
+func (a *Alarm) Check(d *Device) error {
+	return d.check(a.Target, false)
+}
+
+// Run waits and ramps the brightness of the device until ctx is done.
+func (a *Alarm) Run(ctx context.Context, d *Device) error {
+	if err := a.Check(d); err != nil {
+		return err
+	}
+	if err := a.Wait(ctx); err != nil {
+		return err
+	}
+	return a.Raise(ctx, d)
+}
@@ -0,0 +1,55 @@
+// package als provides reading the ambient light sensors.
+package als
+
+import (
+	"errors"
+	"math"
+)
+
+// Source is a source of the ambient light.
+type Source interface {
+	// Lux returns the illuminance in lux.
+	Lux() (float64, error)
+}
+
+// Smoother is the Source that smooths the readings of the underlying Source
+// by the exponential moving average, so the short spikes e.g. shadows are damped.
+type Smoother struct {
+	src   Source
+	alpha float64
+
+	lux   float64
+	valid bool
+}
+
+// NewSmoother returns the Smoother of src.
+// alpha is the weight of the new reading in (0, 1], 1 is no smoothing.
+func NewSmoother(src Source, alpha float64) (*Smoother, error) {
+	if src == nil {
+		return nil, errors.New("source is nil")
+	}
+	if math.IsNaN(alpha) || alpha <= 0 || alpha > 1 {
+		return nil, errors.New("alpha must be in (0, 1]")
+	}
+	return &Smoother{src: src, alpha: alpha}, nil
+}
+
+// Lux reads the underlying Source and returns the smoothed illuminance.
+// The first reading is returned as is.
+func (s *Smoother) Lux() (float64, error) {
+	lux, err := s.src.Lux()
+	if err != nil {
+		return 0, err
+	}
+	if !s.valid {
+		s.lux, s.valid = lux, true
+		return lux, nil
+	}
+	s.lux += s.alpha * (lux - s.lux)
+	return s.lux, nil
+}
+
+// Reset discards the history, e.g. after the resume from suspend.
+func (s *Smoother) Reset() {
+	s.lux, s.valid = 0, false
+}
@@ -0,0 +1,142 @@
+// +build linux
+
+package als
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// expected locations
+// root    : "/sys/bus/iio/devices/"
+// devices : "/sys/bus/iio/devices/iio:device*/"
+// files   : "/sys/bus/iio/devices/iio:device*/in_illuminance{,0}_{input,raw,scale,offset}"
+
+// can modify for test
+var root = "/sys/bus/iio/devices/"
+
+// prefixes of the illuminance channel, the indexed channel is used by some drivers
+var prefixes = []string{"in_illuminance_", "in_illuminance0_"}
+
+const (
+	suffixInput  = "input"
+	suffixRaw    = "raw"
+	suffixScale  = "scale"
+	suffixOffset = "offset"
+
+	baseName = "name"
+)
+
+// Sensor is an IIO illuminance sensor.
+type Sensor struct {
+	// full path to the device directory
+	root string
+
+	// prefix of the channel, e.g. "in_illuminance_"
+	prefix string
+}
+
+// Discover returns the illuminance sensors under the "/sys/bus/iio/devices/".
+func Discover() ([]*Sensor, error) {
+	return DiscoverRoot(root)
+}
+
+// DiscoverRoot returns the illuminance sensors under the dir, e.g. the fake tree for test.
+// The sensors are sorted by the name of the directory.
+func DiscoverRoot(dir string) ([]*Sensor, error) {
+	fis, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var sensors []*Sensor
+	for _, fi := range fis {
+		if fi.Mode()&os.ModeSymlink != 0 {
+			fi, err = os.Stat(filepath.Join(dir, fi.Name()))
+			if err != nil {
+				return nil, err
+			}
+		}
+		if !fi.IsDir() {
+			continue
+		}
+		deviceRoot := filepath.Join(dir, fi.Name())
+		for _, prefix := range prefixes {
+			if exists(deviceRoot, prefix+suffixInput) || exists(deviceRoot, prefix+suffixRaw) {
+				sensors = append(sensors, &Sensor{root: deviceRoot, prefix: prefix})
+				break
+			}
+		}
+	}
+	if len(sensors) == 0 {
+		return nil, errors.New("can not found illuminance sensors")
+	}
+	sort.Slice(sensors, func(i, j int) bool { return sensors[i].ID() < sensors[j].ID() })
+	return sensors, nil
+}
+
+func exists(dir, base string) bool {
+	_, err := os.Stat(filepath.Join(dir, base))
+	return err == nil
+}
+
+// for read the attributes
+func readFloat(file string) (float64, error) {
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseFloat(strings.TrimSpace(string(b)), 64)
+}
+
+// ID returns the name of the directory, e.g. "iio:device0".
+func (s *Sensor) ID() string {
+	return filepath.Base(s.root)
+}
+
+// Name returns the name of the driver, e.g. "acpi-als", or ID if unknown.
+func (s *Sensor) Name() string {
+	b, err := ioutil.ReadFile(filepath.Join(s.root, baseName))
+	if err != nil {
+		return s.ID()
+	}
+	return strings.TrimSpace(string(b))
+}
+
+// Lux returns the calibrated illuminance.
+// The processed input is preferred, otherwise (raw + offset) * scale,
+// missing scale and offset are 1 and 0.
+func (s *Sensor) Lux() (float64, error) {
+	lux, err := readFloat(filepath.Join(s.root, s.prefix+suffixInput))
+	if err == nil || !os.IsNotExist(err) {
+		return lux, err
+	}
+	raw, err := readFloat(filepath.Join(s.root, s.prefix+suffixRaw))
+	if err != nil {
+		return 0, err
+	}
+	scale, err := s.attr(suffixScale, 1)
+	if err != nil {
+		return 0, err
+	}
+	offset, err := s.attr(suffixOffset, 0)
+	if err != nil {
+		return 0, err
+	}
+	return (raw + offset) * scale, nil
+}
+
+// read the attribute of the channel, or the shared one of the type, or def if missing
+func (s *Sensor) attr(suffix string, def float64) (float64, error) {
+	for _, prefix := range []string{s.prefix, prefixes[0]} {
+		f, err := readFloat(filepath.Join(s.root, prefix+suffix))
+		if err == nil || !os.IsNotExist(err) {
+			return f, err
+		}
+	}
+	return def, nil
+}
@@ -0,0 +1,121 @@
+// +build linux
+
+package als
+
+import (
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeFile(dir, base string, content string) error {
+	return ioutil.WriteFile(filepath.Join(dir, base), []byte(content), 0600)
+}
+
+// make the fake device with the attributes
+func makeDevice(dir, name string, attrs map[string]string) (string, error) {
+	deviceRoot := filepath.Join(dir, name)
+	if err := os.Mkdir(deviceRoot, 0700); err != nil {
+		return "", err
+	}
+	for base, content := range attrs {
+		if err := writeFile(deviceRoot, base, content); err != nil {
+			return "", err
+		}
+	}
+	return deviceRoot, nil
+}
+
+func TestDiscover_Linux(t *testing.T) {
+	// expected locations
+	// root    : "/sys/bus/iio/devices/"
+	// devices : "/sys/bus/iio/devices/iio:device*/"
+	testRoot, err := ioutil.TempDir("", "TestDiscover_Linux")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(testRoot)
+
+	tmp := root
+	defer func() { root = tmp }()
+	root = testRoot
+
+	if _, err := Discover(); err == nil {
+		t.Fatal("expected error but nil")
+	}
+
+	for _, test := range []struct {
+		name  string
+		attrs map[string]string
+		exp   float64
+	}{
+		// processed
+		{"iio:device0", map[string]string{"name": "acpi-als\n", "in_illuminance_input": "123.5\n"}, 123.5},
+		// raw with scale and offset
+		{"iio:device1", map[string]string{"in_illuminance_raw": "100\n", "in_illuminance_scale": "0.5\n", "in_illuminance_offset": "-10\n"}, 45},
+		// indexed channel with the shared scale
+		{"iio:device2", map[string]string{"in_illuminance0_raw": "30\n", "in_illuminance_scale": "2\n"}, 60},
+		// raw only
+		{"iio:device3", map[string]string{"in_illuminance_raw": "7\n"}, 7},
+	} {
+		if _, err := makeDevice(testRoot, test.name, test.attrs); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// not an illuminance sensor
+	if _, err := makeDevice(testRoot, "iio:device4", map[string]string{"in_accel_x_raw": "1\n"}); err != nil {
+		t.Fatal(err)
+	}
+
+	sensors, err := Discover()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sensors) != 4 {
+		t.Fatalf("want 4 sensors but out %d", len(sensors))
+	}
+	for i, exp := range []struct {
+		id, name string
+		lux      float64
+	}{
+		{"iio:device0", "acpi-als", 123.5},
+		{"iio:device1", "iio:device1", 45},
+		{"iio:device2", "iio:device2", 60},
+		{"iio:device3", "iio:device3", 7},
+	} {
+		s := sensors[i]
+		if s.ID() != exp.id || s.Name() != exp.name {
+			t.Fatalf("want %s %s but out %s %s", exp.id, exp.name, s.ID(), s.Name())
+		}
+		lux, err := s.Lux()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if math.Abs(lux-exp.lux) > 1e-9 {
+			t.Fatalf("%s want %v but out %v", exp.id, exp.lux, lux)
+		}
+	}
+
+	// invalid value
+	if err := writeFile(filepath.Join(testRoot, "iio:device3"), "in_illuminance_raw", "string"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := sensors[3].Lux(); err == nil {
+		t.Fatal("expected error but nil")
+	}
+
+	// smoothed
+	s, err := NewSmoother(sensors[0], 0.5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Lux()
+	if err := writeFile(filepath.Join(testRoot, "iio:device0"), "in_illuminance_input", "23.5\n"); err != nil {
+		t.Fatal(err)
+	}
+	if lux, err := s.Lux(); err != nil || lux != 73.5 {
+		t.Fatalf("want 73.5 but out %v %v", lux, err)
+	}
+}
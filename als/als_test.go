@@ -0,0 +1,69 @@
+package als
+
+import (
+	"errors"
+	"math"
+	"testing"
+)
+
+// replay the readings
+type trace []float64
+
+func (t *trace) Lux() (float64, error) {
+	if len(*t) == 0 {
+		return 0, errors.New("end of trace")
+	}
+	lux := (*t)[0]
+	*t = (*t)[1:]
+	return lux, nil
+}
+
+func TestSmoother(t *testing.T) {
+	for _, alpha := range []float64{0, -0.5, 1.5, math.NaN()} {
+		if _, err := NewSmoother(&trace{}, alpha); err == nil {
+			t.Fatalf("alpha %v expected error but nil", alpha)
+		}
+	}
+	if _, err := NewSmoother(nil, 0.5); err == nil {
+		t.Fatal("expected error but nil")
+	}
+
+	for _, test := range []struct {
+		alpha float64
+		in    trace
+		exp   []float64
+	}{
+		{1, trace{100, 10, 50}, []float64{100, 10, 50}},
+		{0.5, trace{100, 0, 0, 100}, []float64{100, 50, 25, 62.5}},
+		{0.25, trace{0, 400, 400}, []float64{0, 100, 175}},
+	} {
+		in := test.in
+		s, err := NewSmoother(&in, test.alpha)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i, exp := range test.exp {
+			out, err := s.Lux()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if math.Abs(out-exp) > 1e-9 {
+				t.Fatalf("alpha %v [%d] want %v but out %v", test.alpha, i, exp, out)
+			}
+		}
+		if _, err := s.Lux(); err == nil {
+			t.Fatal("expected error but nil")
+		}
+	}
+
+	in := trace{100, 0}
+	s, err := NewSmoother(&in, 0.5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Lux()
+	s.Reset()
+	if out, err := s.Lux(); err != nil || out != 0 {
+		t.Fatalf("want 0 after reset but out %v %v", out, err)
+	}
+}
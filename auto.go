@@ -0,0 +1,292 @@
+package brightness
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// LuxSource is a source of the ambient light, e.g. the sensor of the package als.
+type LuxSource interface {
+	// Lux returns the illuminance in lux.
+	Lux() (float64, error)
+}
+
+// LuxCurve maps the ambient light in lux to the brightness in percent.
+// The points are interpolated linearly in the logarithm of lux,
+// since the perception of the light is roughly logarithmic.
+type LuxCurve struct {
+	// [lux, percent], sorted by lux
+	points [][2]float64
+}
+
+// NewLuxCurve returns the LuxCurve of the points of [lux, percent].
+// lux must be strictly increasing from 0 or more,
+// and percent must be in [0, 100] and non-decreasing.
+func NewLuxCurve(points [][2]float64) (*LuxCurve, error) {
+	if len(points) == 0 {
+		return nil, errors.New("lux curve requires at least 1 point")
+	}
+	for i, p := range points {
+		if math.IsNaN(p[0]) || math.IsInf(p[0], 0) || p[0] < 0 {
+			return nil, errors.New("lux curve lux must be 0 or more")
+		}
+		if math.IsNaN(p[1]) || p[1] < 0 || p[1] > 100 {
+			return nil, errors.New("lux curve percent must be in [0, 100]")
+		}
+		if i > 0 && (p[0] <= points[i-1][0] || p[1] < points[i-1][1]) {
+			return nil, errors.New("lux curve must be increasing")
+		}
+	}
+	return &LuxCurve{points: append([][2]float64(nil), points...)}, nil
+}
+
+// DefaultLuxCurve returns the curve from the dark room to the direct sunlight.
+func DefaultLuxCurve() *LuxCurve {
+	return &LuxCurve{points: [][2]float64{
+		{0, 10},
+		{10, 30},
+		{100, 50},
+		{1000, 80},
+		{10000, 100},
+	}}
+}
+
+// ParseLuxCurve parses "LUX:PERCENT,LUX:PERCENT,..." e.g. "0:10,100:50,1000:100".
+func ParseLuxCurve(s string) (*LuxCurve, error) {
+	var points [][2]float64
+	for _, field := range strings.Split(s, ",") {
+		kv := strings.SplitN(strings.TrimSpace(field), ":", 2)
+		if len(kv) != 2 {
+			return nil, errors.New("invalid lux curve " + strconv.Quote(s))
+		}
+		lux, err := strconv.ParseFloat(kv[0], 64)
+		if err != nil {
+			return nil, errors.New("invalid lux curve " + strconv.Quote(s))
+		}
+		p, err := strconv.ParseFloat(strings.TrimSuffix(kv[1], "%"), 64)
+		if err != nil {
+			return nil, errors.New("invalid lux curve " + strconv.Quote(s))
+		}
+		points = append(points, [2]float64{lux, p})
+	}
+	return NewLuxCurve(points)
+}
+
+func (c *LuxCurve) String() string {
+	fields := make([]string, 0, len(c.points))
+	for _, p := range c.points {
+		fields = append(fields, strconv.FormatFloat(p[0], 'g', -1, 64)+":"+strconv.FormatFloat(p[1], 'g', -1, 64))
+	}
+	return strings.Join(fields, ",")
+}
+
+// MarshalJSON encodes the points of [lux, percent].
+func (c *LuxCurve) MarshalJSON() ([]byte, error) {
+	return json.Marshal(c.points)
+}
+
+// UnmarshalJSON decodes the points of [lux, percent] as NewLuxCurve.
+func (c *LuxCurve) UnmarshalJSON(b []byte) error {
+	var points [][2]float64
+	if err := json.Unmarshal(b, &points); err != nil {
+		return err
+	}
+	curve, err := NewLuxCurve(points)
+	if err != nil {
+		return err
+	}
+	*c = *curve
+	return nil
+}
+
+// Points returns the copy of the points of [lux, percent].
+func (c *LuxCurve) Points() [][2]float64 {
+	return append([][2]float64(nil), c.points...)
+}
+
+// Percent returns the brightness in percent for the lux.
+func (c *LuxCurve) Percent(lux float64) float64 {
+	x := math.Log1p(math.Max(lux, 0))
+	i := sort.Search(len(c.points), func(i int) bool { return math.Log1p(c.points[i][0]) >= x })
+	switch {
+	case i == 0:
+		return c.points[0][1]
+	case i == len(c.points):
+		return c.points[len(c.points)-1][1]
+	}
+	a, b := c.points[i-1], c.points[i]
+	xa, xb := math.Log1p(a[0]), math.Log1p(b[0])
+	return a[1] + (b[1]-a[1])*(x-xa)/(xb-xa)
+}
+
+// AutoController follows the ambient light from the LuxSource
+// by the brightness of the Device.
+// Modify the fields before Update or Run.
+type AutoController struct {
+	// Curve maps the smoothed lux to the target brightness.
+	Curve *LuxCurve
+
+	// Smoothing is the time constant of the exponential moving average of lux,
+	// no smoothing if 0.
+	Smoothing time.Duration
+
+	// Hysteresis is the minimum change of the target in percent to follow the lux,
+	// so the small changes of the light do not flicker the screen.
+	Hysteresis float64
+
+	// MaxRate is the maximum change of the brightness in percent per second,
+	// unlimited if 0.
+	MaxRate float64
+
+	// Interval is the interval of Update by Run.
+	Interval time.Duration
+
+	// Fade is the duration of the transition of each change by Run, up to Interval.
+	Fade   time.Duration
+	Easing Easing
+
+	// Model learns the Curve from the brightness changed by others while Run,
+	// e.g. akari -inc. Learning is disabled if nil.
+	Model *LuxModel
+
+	// OnLearn is called after learning e.g. to save the Model.
+	OnLearn func(*LuxModel) error
+
+	device *Device
+	source LuxSource
+
+	// the last brightness written by Run
+	written uint
+	wrote   bool
+
+	started bool
+	last    time.Time
+	lux     float64 // smoothed
+	goal    float64 // target in percent after hysteresis
+	output  float64 // brightness in percent after rate limit
+}
+
+// NewAutoController returns the AutoController with the default settings.
+func NewAutoController(d *Device, src LuxSource) *AutoController {
+	return &AutoController{
+		Curve:      DefaultLuxCurve(),
+		Smoothing:  3 * time.Second,
+		Hysteresis: 5,
+		MaxRate:    20,
+		Interval:   time.Second,
+		Fade:       500 * time.Millisecond,
+		Easing:     EaseInOut,
+		device:     d,
+		source:     src,
+	}
+}
+
+// Device returns the controlled device.
+func (a *AutoController) Device() *Device { return a.device }
+
+// Lux returns the last smoothed lux, 0 before the first Update.
+func (a *AutoController) Lux() float64 { return a.lux }
+
+// Reset discards the state, then the next Update starts from the current brightness
+// e.g. after the brightness is changed by others.
+func (a *AutoController) Reset() { a.started = false }
+
+// Update reads the lux at now and returns the brightness to be written.
+// The brightness is limited in [Min(), Cap()] of the device.
+func (a *AutoController) Update(now time.Time) (uint, error) {
+	lux, err := a.source.Lux()
+	if err != nil {
+		return 0, err
+	}
+	if math.IsNaN(lux) || lux < 0 {
+		lux = 0
+	}
+	dt := a.Interval.Seconds()
+	if !a.started {
+		current, err := a.device.Percent()
+		if err != nil {
+			return 0, err
+		}
+		a.lux, a.output = lux, current
+		a.goal = a.Curve.Percent(lux)
+		a.started = true
+	} else {
+		dt = now.Sub(a.last).Seconds()
+		if dt < 0 {
+			dt = 0
+		}
+		alpha := 1.0
+		if a.Smoothing > 0 {
+			alpha = 1 - math.Exp(-dt/a.Smoothing.Seconds())
+		}
+		a.lux += alpha * (lux - a.lux)
+		if want := a.Curve.Percent(a.lux); !(math.Abs(want-a.goal) < a.Hysteresis) {
+			a.goal = want
+		}
+	}
+	a.last = now
+
+	step := a.goal - a.output
+	if a.MaxRate > 0 {
+		limit := a.MaxRate * dt
+		step = math.Max(-limit, math.Min(limit, step))
+	}
+	a.output += step
+
+	target := a.device.RawOf(a.output, RoundNearest)
+	if min := a.device.Min(); target < min {
+		target = min
+	}
+	if cap := a.device.Cap(); target > cap {
+		target = cap
+	}
+	return target, nil
+}
+
+// Run updates the brightness at every Interval until ctx is done,
+// and returns ctx.Err() or the error of Update and writes.
+// If the Model is not nil, the brightness changed by others is learned.
+func (a *AutoController) Run(ctx context.Context) error {
+	if a.Interval <= 0 {
+		return errors.New("interval must be positive")
+	}
+	fade := a.Fade
+	if fade > a.Interval {
+		fade = a.Interval
+	}
+	ticker := time.NewTicker(a.Interval)
+	defer ticker.Stop()
+	a.wrote = false
+	for {
+		current, err := a.device.Current()
+		if err != nil {
+			return err
+		}
+		if a.Model != nil && a.wrote && current != a.written {
+			if err := a.Learn(current); err != nil {
+				return err
+			}
+		}
+		target, err := a.Update(time.Now())
+		if err != nil {
+			return err
+		}
+		if target != current {
+			if err := a.device.FadeTo(ctx, target, fade, a.Easing); err != nil {
+				return err
+			}
+		}
+		a.written, a.wrote = target, true
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
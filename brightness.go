@@ -4,12 +4,13 @@ package brightness
 import (
 	"errors"
 	"regexp"
-	"sort"
 	"strconv"
+	"sync"
+	"time"
 )
 
-// implement in brightness_*.go
-type internal interface {
+// Controller is a single device provided by a Backend.
+type Controller interface {
 	// expected name is always unique
 	Name() string
 	Current() (uint, error)
@@ -17,18 +18,167 @@ type internal interface {
 	Set(uint) error
 }
 
+// Backend is a source of devices, e.g. sysfs on linux.
+// Register it to make its devices visible from ReadDeviceAll.
+type Backend interface {
+	// Discover returns the devices currently provided by the backend.
+	// returning no devices is not an error.
+	Discover() ([]Controller, error)
+}
+
+// device classes
+const (
+	ClassBacklight = "backlight"
+	ClassLEDs      = "leds"
+)
+
+// Controller may implement Classer to report the class of the device.
+type Classer interface {
+	Class() string
+}
+
+// Metadata is the additional information of the device.
+// fields are empty if unknown.
+type Metadata struct {
+	// backlight type, "firmware", "platform" or "raw"
+	Type string
+
+	// resolved path of the device, e.g. "/sys/devices/.../intel_backlight"
+	Path string
+
+	// bound driver of the parent device, e.g. "i915"
+	Driver string
+
+	// parent device, e.g. "0000:00:02.0"
+	Parent string
+
+	// subsystem of the parent device, e.g. "pci"
+	Subsystem string
+}
+
+// Controller may implement Describer to report the Metadata.
+type Describer interface {
+	Metadata() (Metadata, error)
+}
+
+// Controller may implement ActualReader to report the brightness
+// that the hardware actually applied.
+type ActualReader interface {
+	Actual() (uint, error)
+}
+
+// ErrNotSupported is returned when the device does not support the operation.
+var ErrNotSupported = errors.New("not supported by the device")
+
+// registered backends, keep the order of Register
+var backends struct {
+	sync.Mutex
+	names []string
+	m     map[string]Backend
+}
+
+// Register makes a backend available by the provided name.
+// If Register is called twice with the same name or if backend is nil, it panics.
+func Register(name string, backend Backend) {
+	backends.Lock()
+	defer backends.Unlock()
+	if backend == nil {
+		panic("brightness: Register backend is nil")
+	}
+	if _, dup := backends.m[name]; dup {
+		panic("brightness: Register called twice for backend " + name)
+	}
+	if backends.m == nil {
+		backends.m = make(map[string]Backend)
+	}
+	backends.m[name] = backend
+	backends.names = append(backends.names, name)
+}
+
+// Unregister removes the backend registered by the name.
+// It is no-op if the name is not registered.
+func Unregister(name string) {
+	backends.Lock()
+	defer backends.Unlock()
+	if _, ok := backends.m[name]; !ok {
+		return
+	}
+	delete(backends.m, name)
+	for i, n := range backends.names {
+		if n == name {
+			backends.names = append(backends.names[:i], backends.names[i+1:]...)
+			break
+		}
+	}
+}
+
+// Backends returns the names of registered backends in order of registration.
+func Backends() []string {
+	backends.Lock()
+	defer backends.Unlock()
+	return append([]string(nil), backends.names...)
+}
+
 type Device struct {
-	internal internal
+	internal Controller
+
+	// nil is the default, see Curve
+	curve Curve
+
+	// nil is DefaultPolicy
+	policy *Policy
+
+	// verify after write, see EnableVerify
+	verify   bool
+	retries  int
+	interval time.Duration
+
+	// name of the backend that provides the device
+	backend string
 
 	// TODO: remove? to use Max()(uint, error)?
 	// expected max is always greater than 1
 	max uint
 }
 
-// implement in brightness_*.go
-var readDeviceAll func() ([]*Device, error)
+// can replace for test
+var readDeviceAll = discoverAll
+
+// merge devices from all registered backends
+func discoverAll() ([]*Device, error) {
+	backends.Lock()
+	names := append([]string(nil), backends.names...)
+	bs := make([]Backend, 0, len(names))
+	for _, name := range names {
+		bs = append(bs, backends.m[name])
+	}
+	backends.Unlock()
+
+	var devices []*Device
+	for i, b := range bs {
+		cs, err := b.Discover()
+		if err != nil {
+			return nil, errors.New(names[i] + ": " + err.Error())
+		}
+		for _, c := range cs {
+			devices = append(devices, &Device{
+				internal: c,
+				backend:  names[i],
+			})
+		}
+	}
+	if len(devices) == 0 {
+		return nil, errors.New("can not found devices")
+	}
+	return devices, nil
+}
 
 func ReadDeviceAll() ([]*Device, error) {
+	return ReadDeviceAllOrder(DefaultOrder)
+}
+
+// ReadDeviceAllOrder is ReadDeviceAll sorted by the order instead of DefaultOrder.
+func ReadDeviceAllOrder(order Order) ([]*Device, error) {
 	devices, err := readDeviceAll()
 	if err != nil {
 		return nil, err
@@ -52,16 +202,19 @@ func ReadDeviceAll() ([]*Device, error) {
 			duplicate[name] = true
 		}
 	}
-	sort.Slice(devices, func(i, j int) bool {
-		return devices[i].Name() < devices[j].Name()
-	})
+	SortDevices(devices, order)
 	return devices, nil
 }
 
 // TODO: is need?
 // change to func(index ...int) ([]*Device, error)?
 func ReadDeviceIndex(index int) (*Device, error) {
-	devices, err := ReadDeviceAll()
+	return ReadDeviceIndexOrder(index, DefaultOrder)
+}
+
+// ReadDeviceIndexOrder is ReadDeviceIndex in the order instead of DefaultOrder.
+func ReadDeviceIndexOrder(index int, order Order) (*Device, error) {
+	devices, err := ReadDeviceAllOrder(order)
 	if err != nil {
 		return nil, err
 	}
@@ -95,82 +248,78 @@ func ReadDevicePat(pat string) ([]*Device, error) {
 }
 
 func (d *Device) Name() string           { return d.internal.Name() }
+func (d *Device) Backend() string        { return d.backend }
 func (d *Device) Current() (uint, error) { return d.internal.Current() }
 
+// Class returns the class of the device, e.g. ClassBacklight.
+// return empty string if the backend does not report it.
+func (d *Device) Class() string {
+	if c, ok := d.internal.(Classer); ok {
+		return c.Class()
+	}
+	return ""
+}
+
+// Metadata returns the zero Metadata if the backend does not report it.
+func (d *Device) Metadata() (Metadata, error) {
+	if m, ok := d.internal.(Describer); ok {
+		return m.Metadata()
+	}
+	return Metadata{}, nil
+}
+
+// Max returns the max brightness of the hardware, see Cap for the limit of Policy.
 func (d *Device) Max() uint { return d.max }
+
+// Mid is limited in [Min(), Cap()].
 func (d *Device) Mid() uint {
+	mid := d.max / 2
 	if d.max == 1 {
-		return 1
+		mid = 1
 	}
-	return d.max / 2
-}
-func (d *Device) Min() uint {
-	if d.max < 10 {
-		return 1
+	if min := d.Min(); mid < min {
+		return min
+	}
+	if cap := d.Cap(); mid > cap {
+		return cap
 	}
-	return d.max / 10
+	return mid
 }
 
-// if force is true then ignore the limit
+// if force is true then ignore the Policy
 func (d *Device) Set(want uint, force bool) error {
+	if err := d.check(want, force); err != nil {
+		return err
+	}
+	return d.write(want)
+}
+
+// limits for Set
+func (d *Device) check(want uint, force bool) error {
 	if want > d.max {
 		return errors.New("requested brightness over the max")
 	}
 	if force {
-		return d.internal.Set(want)
+		return nil
+	}
+	if want == 0 && d.Policy().AllowZero {
+		return nil
 	}
 	if want == 0 {
 		return errors.New("can not set brightness to 0")
 	}
-	if d.max > 10 && want < d.max/10 {
-		return errors.New("can not set brightness under the 10 percent")
+	if min := d.Min(); want < min {
+		return errors.New("can not set brightness under the limit " + strconv.FormatUint(uint64(min), 10))
 	}
-	return d.internal.Set(want)
-}
-
-func (d *Device) SetMax() error { return d.internal.Set(d.max) }
-func (d *Device) SetMid() error { return d.internal.Set(d.Mid()) }
-func (d *Device) SetMin() error { return d.internal.Set(d.Min()) }
-
-// provide?: SetPercent(i int) error
-
-func (d *Device) Inc10Percent() error {
-	current, err := d.internal.Current()
-	if err != nil {
-		return err
-	}
-	var want uint
-	if d.max < 10 {
-		want = current + 1
-	} else {
-		want = current + d.max/10
-	}
-	if want > d.max {
-		want = d.max
+	if cap := d.Cap(); want > cap {
+		return errors.New("can not set brightness over the cap " + strconv.FormatUint(uint64(cap), 10))
 	}
-	return d.internal.Set(want)
+	return nil
 }
 
-func (d *Device) Dec10Percent() error {
-	current, err := d.internal.Current()
-	if err != nil {
-		return err
-	}
-	if current <= 1 {
-		return nil
-	}
-	var want uint
-	if d.max < 10 {
-		want = current - 1
-	} else {
-		tenPercent := d.max / 10
-		if current <= tenPercent {
-			return nil
-		}
-		want = current - tenPercent
-		if want < tenPercent {
-			want = tenPercent
-		}
-	}
-	return d.internal.Set(want)
-}
+func (d *Device) SetMax() error { return d.write(d.Cap()) }
+func (d *Device) SetMid() error { return d.write(d.Mid()) }
+func (d *Device) SetMin() error { return d.write(d.Min()) }
+
+func (d *Device) Inc10Percent() error { return d.Step(PercentDelta(10)) }
+func (d *Device) Dec10Percent() error { return d.Step(PercentDelta(-10)) }
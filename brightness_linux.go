@@ -9,54 +9,119 @@ import (
 	"path/filepath"
 	"strconv"
 	"strings"
+	"syscall"
 )
 
 // expected locations
-// root    : "/sys/class/backlight/"
-// devices : "/sys/class/backlight/*/"
-// files   : "/sys/class/backlight/*/{max_,}brightness"
+// root    : "/sys/class/{backlight,leds}/"
+// devices : "/sys/class/{backlight,leds}/*/"
+// files   : "/sys/class/{backlight,leds}/*/{max_,}brightness"
 
 // can modify for test
-var root = "/sys/class/backlight/"
+var (
+	root     = "/sys/class/backlight/"
+	ledsRoot = "/sys/class/leds/"
+)
+
+const (
+	baseCurrent   = "brightness"
+	baseMax       = "max_brightness"
+	baseActual    = "actual_brightness"
+	baseHwChanged = "brightness_hw_changed"
+	basePower     = "bl_power"
+	baseScale     = "scale"
+
+	// for Metadata
+	baseType   = "type"
+	baseParent = "device"
+	baseDriver = "driver"
+	baseSubsys = "subsystem"
+)
 
+// values of bl_power, FB_BLANK_UNBLANK and FB_BLANK_POWERDOWN in linux/fb.h
 const (
-	baseCurrent = "brightness"
-	baseMax     = "max_brightness"
+	powerOn  = 0
+	powerOff = 4
 )
 
 func init() {
-	readDeviceAll = func() ([]*Device, error) {
-		fis, err := ioutil.ReadDir(root)
+	Register("sysfs", sysfs{})
+}
+
+// implement for the type Backend
+type sysfs struct {
+	// use root and ledsRoot if empty
+	backlight, leds string
+
+	// write through logind if not nil
+	logind *Logind
+}
+
+// NewSysfs returns the linux Backend reading the devices under the sysfs,
+// e.g. "/sys" or the fake tree for test.
+// The Backend registered by default is named "sysfs" and reads "/sys".
+func NewSysfs(sysfsRoot string, opts ...SysfsOption) Backend {
+	s := sysfs{
+		backlight: filepath.Join(sysfsRoot, "class", ClassBacklight),
+		leds:      filepath.Join(sysfsRoot, "class", ClassLEDs),
+	}
+	for _, opt := range opts {
+		opt(&s)
+	}
+	return s
+}
+
+func (s sysfs) Discover() ([]Controller, error) {
+	backlight, leds := s.backlight, s.leds
+	if backlight == "" && leds == "" {
+		backlight, leds = root, ledsRoot
+	}
+	var controllers []Controller
+	for _, class := range []struct {
+		name, root string
+	}{
+		{ClassBacklight, backlight},
+		{ClassLEDs, leds},
+	} {
+		cs, err := discoverClass(class.name, class.root, s.logind)
 		if err != nil {
 			return nil, err
 		}
-		devices := make([]*Device, 0, len(fis))
-		for _, fi := range fis {
-			if fi.Mode()&os.ModeSymlink != 0 {
-				fi, err = os.Stat(filepath.Join(root, fi.Name()))
-				if err != nil {
-					return nil, err
-				}
-			}
-			if fi.IsDir() {
-				internal := &device{
-					root: filepath.Join(root, fi.Name()),
-				}
-				max, err := internal.Max()
-				if err != nil {
-					return nil, err
-				}
-				devices = append(devices, &Device{
-					internal: internal,
-					max:      max,
-				})
+		controllers = append(controllers, cs...)
+	}
+	return controllers, nil
+}
+
+// missing classRoot is not an error, e.g. desktop has no backlight
+func discoverClass(class, classRoot string, logind *Logind) ([]Controller, error) {
+	fis, err := ioutil.ReadDir(classRoot)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	controllers := make([]Controller, 0, len(fis))
+	for _, fi := range fis {
+		if fi.Mode()&os.ModeSymlink != 0 {
+			fi, err = os.Stat(filepath.Join(classRoot, fi.Name()))
+			if err != nil {
+				return nil, err
 			}
 		}
-		if len(devices) < 1 {
-			return nil, errors.New("not found devices in " + root)
+		if fi.IsDir() {
+			internal := &device{
+				root:   filepath.Join(classRoot, fi.Name()),
+				class:  class,
+				logind: logind,
+			}
+			if _, err := internal.Max(); err != nil {
+				return nil, err
+			}
+			controllers = append(controllers, internal)
 		}
-		return devices, nil
 	}
+	return controllers, nil
 }
 
 // for read {max_,}brightness
@@ -69,20 +134,130 @@ func readUint(file string) (uint, error) {
 	return uint(i), err
 }
 
-// implement for the type internal
+// for write brightness and bl_power, the file is expected to exist
+func writeUint(file string, ui uint) error {
+	f, err := os.OpenFile(file, os.O_WRONLY|os.O_TRUNC, 0)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = f.WriteString(strconv.FormatUint(uint64(ui), 10))
+	return err
+}
+
+// implement for the type Controller
 type device struct {
 	// full path to target device directory
 	root string
+
+	// ClassBacklight or ClassLEDs
+	class string
+
+	// write through logind if not nil
+	logind *Logind
 }
 
 func (d *device) Name() string {
 	return filepath.Base(d.root)
 }
 
+func (d *device) Class() string {
+	return d.class
+}
+
+// missing attributes are left empty
+func (d *device) Metadata() (Metadata, error) {
+	var m Metadata
+	b, err := ioutil.ReadFile(filepath.Join(d.root, baseType))
+	switch {
+	case err == nil:
+		m.Type = strings.TrimSpace(string(b))
+	case !os.IsNotExist(err):
+		return Metadata{}, err
+	}
+	m.Path, err = filepath.EvalSymlinks(d.root)
+	if err != nil {
+		return Metadata{}, err
+	}
+	parent, err := filepath.EvalSymlinks(filepath.Join(d.root, baseParent))
+	switch {
+	case err == nil:
+		m.Parent = filepath.Base(parent)
+	case !os.IsNotExist(err):
+		return Metadata{}, err
+	}
+	driver, err := filepath.EvalSymlinks(filepath.Join(d.root, baseParent, baseDriver))
+	switch {
+	case err == nil:
+		m.Driver = filepath.Base(driver)
+	case !os.IsNotExist(err):
+		return Metadata{}, err
+	}
+	subsystem, err := filepath.EvalSymlinks(filepath.Join(d.root, baseParent, baseSubsys))
+	switch {
+	case err == nil:
+		m.Subsystem = filepath.Base(subsystem)
+	case !os.IsNotExist(err):
+		return Metadata{}, err
+	}
+	return m, nil
+}
+
 func (d *device) Current() (uint, error) {
 	return readUint(filepath.Join(d.root, baseCurrent))
 }
 
+// LEDs has no actual_brightness
+func (d *device) Actual() (uint, error) {
+	ui, err := readUint(filepath.Join(d.root, baseActual))
+	if os.IsNotExist(err) {
+		return 0, ErrNotSupported
+	}
+	return ui, err
+}
+
+// brightness_hw_changed is exists only in LEDs supporting it,
+// and the read fails with ENODATA until the hardware changes the brightness
+func (d *device) HardwareChanged() (uint, error) {
+	ui, err := readUint(filepath.Join(d.root, baseHwChanged))
+	if os.IsNotExist(err) {
+		return 0, ErrNotSupported
+	}
+	if pe, ok := err.(*os.PathError); ok && pe.Err == syscall.ENODATA {
+		return 0, ErrNoHardwareChange
+	}
+	return ui, err
+}
+
+// bl_power is exists only in backlight class
+func (d *device) Powered() (bool, error) {
+	ui, err := readUint(filepath.Join(d.root, basePower))
+	if os.IsNotExist(err) {
+		return false, ErrNotSupported
+	}
+	return ui == powerOn, err
+}
+
+func (d *device) SetPower(on bool) error {
+	var ui uint = powerOff
+	if on {
+		ui = powerOn
+	}
+	err := writeUint(filepath.Join(d.root, basePower), ui)
+	if os.IsNotExist(err) {
+		return ErrNotSupported
+	}
+	return err
+}
+
+func (d *device) Scale() (string, error) {
+	b, err := ioutil.ReadFile(filepath.Join(d.root, baseScale))
+	if os.IsNotExist(err) {
+		return "", ErrNotSupported
+	}
+	return strings.TrimSpace(string(b)), err
+}
+
 func (d *device) Max() (uint, error) {
 	return readUint(filepath.Join(d.root, baseMax))
 }
@@ -95,11 +270,12 @@ func (d *device) Set(ui uint) error {
 	if ui > max {
 		return errors.New("requested brightness over the max")
 	}
-	f, err := os.OpenFile(filepath.Join(d.root, baseCurrent), os.O_WRONLY|os.O_TRUNC, 0)
-	if err != nil {
-		return err
+	if d.logind != nil && d.logind.Always {
+		return d.logind.SetBrightness(d.class, d.Name(), uint32(ui))
+	}
+	err = writeUint(filepath.Join(d.root, baseCurrent), ui)
+	if d.logind.fallback(err) {
+		return d.logind.SetBrightness(d.class, d.Name(), uint32(ui))
 	}
-	defer f.Close()
-	_, err = f.WriteString(strconv.FormatUint(uint64(ui), 10))
 	return err
 }
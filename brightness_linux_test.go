@@ -3,12 +3,14 @@
 package brightness
 
 import (
+	"context"
 	"io/ioutil"
 	"os"
 	"path/filepath"
 	"reflect"
 	"sort"
 	"testing"
+	"time"
 )
 
 func writeFile(dir, base string, content string) error {
@@ -135,12 +137,12 @@ func TestReadDevice_Linux(t *testing.T) {
 	}
 	defer os.RemoveAll(testRoot)
 
-	verify := func(t *testing.T, classRoot string, exp []*Device, wanterr bool) {
+	verifyClasses := func(t *testing.T, classRoot, classLEDsRoot string, exp []*Device, wanterr bool) {
 		t.Helper()
-		tmp := root
-		defer func() { root = tmp }()
-		root = classRoot
-		out, err := readDeviceAll()
+		tmp, tmpLEDs := root, ledsRoot
+		defer func() { root, ledsRoot = tmp, tmpLEDs }()
+		root, ledsRoot = classRoot, classLEDsRoot
+		out, err := ReadDeviceAll()
 		if wanterr {
 			if err != nil {
 				return
@@ -166,6 +168,11 @@ func TestReadDevice_Linux(t *testing.T) {
 		}
 	}
 
+	verify := func(t *testing.T, classRoot string, exp []*Device, wanterr bool) {
+		t.Helper()
+		verifyClasses(t, classRoot, filepath.Join(testRoot, "not exist"), exp, wanterr)
+	}
+
 	t.Run("Read One", func(t *testing.T) {
 		classRoot, err := ioutil.TempDir(testRoot, "")
 		if err != nil {
@@ -177,7 +184,8 @@ func TestReadDevice_Linux(t *testing.T) {
 		}
 		exp := []*Device{
 			{
-				internal: &device{root: deviceRoot},
+				internal: &device{root: deviceRoot, class: ClassBacklight},
+				backend:  "sysfs",
 				max:      100,
 			},
 		}
@@ -204,17 +212,56 @@ func TestReadDevice_Linux(t *testing.T) {
 		}
 		exp := []*Device{
 			{
-				internal: &device{deviceRoot},
+				internal: &device{root: deviceRoot, class: ClassBacklight},
+				backend:  "sysfs",
 				max:      100,
 			},
 			{
-				internal: &device{sym},
+				internal: &device{root: sym, class: ClassBacklight},
+				backend:  "sysfs",
 				max:      100,
 			},
 		}
 		verify(t, classRoot, exp, false)
 	})
 
+	t.Run("Read LEDs", func(t *testing.T) {
+		classRoot, err := ioutil.TempDir(testRoot, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		classLEDsRoot, err := ioutil.TempDir(testRoot, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		deviceRoot, err := makeDeviceDir(classRoot, "100", "100")
+		if err != nil {
+			t.Fatal(err)
+		}
+		ledRoot, err := makeDeviceDir(classLEDsRoot, "1", "3")
+		if err != nil {
+			t.Fatal(err)
+		}
+		backlight := &Device{
+			internal: &device{root: deviceRoot, class: ClassBacklight},
+			backend:  "sysfs",
+			max:      100,
+		}
+		led := &Device{
+			internal: &device{root: ledRoot, class: ClassLEDs},
+			backend:  "sysfs",
+			max:      3,
+		}
+		verifyClasses(t, classRoot, classLEDsRoot, []*Device{backlight, led}, false)
+
+		// only LEDs
+		err = os.RemoveAll(classRoot)
+		if err != nil {
+			t.Fatal(err)
+		}
+		verifyClasses(t, classRoot, classLEDsRoot, []*Device{led}, false)
+	})
+
 	// want error
 
 	t.Run("Not Found Devices Root", func(t *testing.T) {
@@ -274,3 +321,386 @@ func TestReadDevice_Linux(t *testing.T) {
 		verify(t, classRoot, nil, true)
 	})
 }
+
+func TestMetadata_Linux(t *testing.T) {
+	// expected locations
+	// deviceRoot : "/sys/class/backlight/*/"
+	// files      : "/sys/class/backlight/*/type"
+	// parent     : "/sys/class/backlight/*/device" -> "/sys/devices/pci0000:00/0000:00:02.0"
+	// driver     : "/sys/devices/pci0000:00/0000:00:02.0/driver" -> "/sys/bus/pci/drivers/i915"
+	// subsystem  : "/sys/devices/pci0000:00/0000:00:02.0/subsystem" -> "/sys/bus/pci"
+	testRoot, err := ioutil.TempDir("", "TestMetadata_Linux")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(testRoot)
+
+	deviceRoot, err := makeDeviceDir(testRoot, "100", "100")
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := &device{root: deviceRoot, class: ClassBacklight}
+
+	t.Run("Empty", func(t *testing.T) {
+		m, err := d.Metadata()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if exp := (Metadata{Path: deviceRoot}); m != exp {
+			t.Fatalf("exp %+v but out %+v", exp, m)
+		}
+	})
+
+	t.Run("Full", func(t *testing.T) {
+		parent := filepath.Join(testRoot, "0000:00:02.0")
+		driver := filepath.Join(testRoot, "i915")
+		subsystem := filepath.Join(testRoot, "pci")
+		for _, dir := range []string{parent, driver, subsystem} {
+			if err := os.Mkdir(dir, 0700); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := os.Symlink(driver, filepath.Join(parent, baseDriver)); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Symlink(subsystem, filepath.Join(parent, baseSubsys)); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Symlink(parent, filepath.Join(deviceRoot, baseParent)); err != nil {
+			t.Fatal(err)
+		}
+		if err := writeFile(deviceRoot, baseType, "raw\n"); err != nil {
+			t.Fatal(err)
+		}
+		m, err := d.Metadata()
+		if err != nil {
+			t.Fatal(err)
+		}
+		exp := Metadata{
+			Type:      "raw",
+			Path:      deviceRoot,
+			Driver:    "i915",
+			Parent:    "0000:00:02.0",
+			Subsystem: "pci",
+		}
+		if m != exp {
+			t.Fatalf("exp %+v but out %+v", exp, m)
+		}
+	})
+}
+
+func TestActual_Linux(t *testing.T) {
+	testRoot, err := ioutil.TempDir("", "TestActual_Linux")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(testRoot)
+
+	deviceRoot, err := makeDeviceDir(testRoot, "100", "100")
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := &device{root: deviceRoot, class: ClassLEDs}
+	if _, err := d.Actual(); err != ErrNotSupported {
+		t.Fatalf("expected ErrNotSupported but %v", err)
+	}
+
+	if err := writeFile(deviceRoot, baseActual, "42\n"); err != nil {
+		t.Fatal(err)
+	}
+	out, err := d.Actual()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out != 42 {
+		t.Fatalf("want 42 but out %d", out)
+	}
+}
+
+func TestNotify_Linux(t *testing.T) {
+	testRoot, err := ioutil.TempDir("", "TestNotify_Linux")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(testRoot)
+
+	deviceRoot, err := makeDeviceDir(testRoot, "50", "100")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// only by inotify
+	tmp := WatchInterval
+	defer func() { WatchInterval = tmp }()
+	WatchInterval = time.Hour
+
+	d := &Device{internal: &device{root: deviceRoot, class: ClassBacklight}, max: 100}
+	ctx, cancel := context.WithCancel(context.Background())
+	ch := d.Watch(ctx)
+
+	if err := writeFile(deviceRoot, baseCurrent, "70"); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case c := <-ch:
+		if c.Old != 50 || c.New != 70 || c.Source != SourceSoftware {
+			t.Fatalf("unexpected change %+v", c)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout")
+	}
+
+	// the kernel notifies brightness_hw_changed
+	d = &Device{internal: &device{root: deviceRoot, class: ClassLEDs}, max: 100}
+	if _, err := d.HardwareChanged(); err != ErrNotSupported {
+		t.Fatalf("expected ErrNotSupported but %v", err)
+	}
+	if err := writeFile(deviceRoot, baseHwChanged, "30\n"); err != nil {
+		t.Fatal(err)
+	}
+	if out, err := d.HardwareChanged(); err != nil || out != 30 {
+		t.Fatalf("want 30 but out %d %v", out, err)
+	}
+	ch = d.Watch(ctx)
+	if err := writeFile(deviceRoot, baseHwChanged, "40\n"); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeFile(deviceRoot, baseCurrent, "40"); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case c := <-ch:
+		if c.Old != 70 || c.New != 40 || c.Source != SourceHardware {
+			t.Fatalf("unexpected change %+v", c)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout")
+	}
+
+	cancel()
+	for range ch {
+	}
+}
+
+func TestPower_Linux(t *testing.T) {
+	testRoot, err := ioutil.TempDir("", "TestPower_Linux")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(testRoot)
+
+	deviceRoot, err := makeDeviceDir(testRoot, "100", "100")
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := &device{root: deviceRoot, class: ClassBacklight}
+	if _, err := d.Powered(); err != ErrNotSupported {
+		t.Fatalf("expected ErrNotSupported but %v", err)
+	}
+	if err := d.SetPower(false); err != ErrNotSupported {
+		t.Fatalf("expected ErrNotSupported but %v", err)
+	}
+
+	if err := writeFile(deviceRoot, basePower, "0\n"); err != nil {
+		t.Fatal(err)
+	}
+	for _, on := range []bool{false, true, false} {
+		if err := d.SetPower(on); err != nil {
+			t.Fatal(err)
+		}
+		out, err := d.Powered()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if out != on {
+			t.Fatalf("want %v but out %v", on, out)
+		}
+		current, err := d.Current()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if current != 100 {
+			t.Fatalf("brightness is changed to %d", current)
+		}
+	}
+}
+
+func TestPersister_Linux(t *testing.T) {
+	// expected locations
+	// sysfs  : "/sys/"
+	// device : "/sys/class/backlight/*/"
+	testRoot, err := ioutil.TempDir("", "TestPersister_Linux")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(testRoot)
+
+	sysfsRoot := filepath.Join(testRoot, "sys")
+	classRoot := filepath.Join(sysfsRoot, "class", ClassBacklight)
+	if err := os.MkdirAll(classRoot, 0700); err != nil {
+		t.Fatal(err)
+	}
+	deviceRoot, err := makeDeviceDir(classRoot, "0", "100")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cs, err := NewSysfs(sysfsRoot).Discover()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cs) != 1 {
+		t.Fatalf("expected 1 device but %d", len(cs))
+	}
+	devices := []*Device{{internal: cs[0], backend: "sysfs", max: 100}}
+	p := &Persister{Dir: filepath.Join(testRoot, "state")}
+
+	// no saved state
+	if err := p.Load(devices...); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, test := range []struct {
+		saved, loaded string
+	}{
+		{"50", "50"},
+		// saved 0 is clamped
+		{"0", "10"},
+		{"100", "100"},
+	} {
+		if err := writeFile(deviceRoot, baseCurrent, test.saved); err != nil {
+			t.Fatal(err)
+		}
+		if err := p.Save(devices...); err != nil {
+			t.Fatal(err)
+		}
+		if err := writeFile(deviceRoot, baseCurrent, "30"); err != nil {
+			t.Fatal(err)
+		}
+		if err := p.Load(devices...); err != nil {
+			t.Fatal(err)
+		}
+		b, err := ioutil.ReadFile(filepath.Join(deviceRoot, baseCurrent))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(b) != test.loaded {
+			t.Fatalf("saved %s, want %s but loaded %s", test.saved, test.loaded, b)
+		}
+	}
+
+	// max is changed
+	if err := writeFile(deviceRoot, baseCurrent, "50"); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Save(devices...); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeFile(deviceRoot, baseMax, "1000"); err != nil {
+		t.Fatal(err)
+	}
+	devices[0].max = 1000
+	if err := p.Load(devices...); err != nil {
+		t.Fatal(err)
+	}
+	out, err := devices[0].Current()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out != 500 {
+		t.Fatalf("want 500 but out %d", out)
+	}
+
+	// the LEDs are not clamped, the keyboard backlight saved off is kept off
+	ledRoot := filepath.Join(sysfsRoot, "class", ClassLEDs)
+	if err := os.MkdirAll(ledRoot, 0700); err != nil {
+		t.Fatal(err)
+	}
+	ledDir, err := makeDeviceDir(ledRoot, "0", "3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cs, err = NewSysfs(sysfsRoot).Discover()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var led *Device
+	for _, c := range cs {
+		if c.(Classer).Class() == ClassLEDs {
+			led = &Device{internal: c, backend: "sysfs", max: 3}
+		}
+	}
+	if led == nil {
+		t.Fatal("not found the LED")
+	}
+	if err := p.Save(led); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeFile(ledDir, baseCurrent, "2"); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Load(led); err != nil {
+		t.Fatal(err)
+	}
+	b, err := ioutil.ReadFile(filepath.Join(ledDir, baseCurrent))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "0" {
+		t.Fatalf("want 0 but loaded %s", b)
+	}
+}
+
+func TestUdevRules_Linux(t *testing.T) {
+	testRoot, err := ioutil.TempDir("", "TestUdevRules_Linux")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(testRoot)
+
+	sysfsRoot := filepath.Join(testRoot, "sys")
+	for _, dir := range []string{
+		filepath.Join(sysfsRoot, "class", ClassBacklight, "intel_backlight"),
+		filepath.Join(sysfsRoot, "class", ClassBacklight, "acpi_video0"),
+		filepath.Join(sysfsRoot, "class", ClassLEDs, "tpacpi::kbd_backlight"),
+	} {
+		if err := os.MkdirAll(dir, 0700); err != nil {
+			t.Fatal(err)
+		}
+		if err := writeFile(dir, baseCurrent, "1"); err != nil {
+			t.Fatal(err)
+		}
+		if err := writeFile(dir, baseMax, "2"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	cs, err := NewSysfs(sysfsRoot).Discover()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var devices []*Device
+	for _, c := range cs {
+		devices = append(devices, &Device{internal: c, max: 2})
+	}
+
+	out, err := UdevRules(devices, "video")
+	if err != nil {
+		t.Fatal(err)
+	}
+	exp := `# generated by akari setup-udev
+# permit the group video to write the brightness
+ACTION=="add", SUBSYSTEM=="backlight", KERNEL=="acpi_video0", RUN+="/bin/chgrp video /sys/class/backlight/%k/brightness", RUN+="/bin/chmod g+w /sys/class/backlight/%k/brightness"
+ACTION=="add", SUBSYSTEM=="backlight", KERNEL=="intel_backlight", RUN+="/bin/chgrp video /sys/class/backlight/%k/brightness", RUN+="/bin/chmod g+w /sys/class/backlight/%k/brightness"
+ACTION=="add", SUBSYSTEM=="leds", KERNEL=="tpacpi::kbd_backlight", RUN+="/bin/chgrp video /sys/class/leds/%k/brightness", RUN+="/bin/chmod g+w /sys/class/leds/%k/brightness"
+`
+	if out != exp {
+		t.Fatalf("exp:\n%s\nout:\n%s", exp, out)
+	}
+
+	for _, group := range []string{"", "Video", "video group", "video;rm"} {
+		if _, err := UdevRules(devices, group); err == nil {
+			t.Fatalf("%q expected error but nil", group)
+		}
+	}
+	if _, err := UdevRules(nil, "video"); err == nil {
+		t.Fatal("expected error but nil")
+	}
+}
@@ -1,11 +1,19 @@
 package brightness
 
 import (
+	"bytes"
+	"context"
 	"errors"
 	"fmt"
+	"io/ioutil"
+	"math"
+	"os"
 	"reflect"
 	"sort"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 )
 
 // for Device
@@ -612,3 +620,1829 @@ func TestReadDevice(t *testing.T) {
 		}
 	})
 }
+
+// for Backend
+type mockBackend struct {
+	mocks []*mock
+	err   error
+}
+
+func (b *mockBackend) Discover() ([]Controller, error) {
+	cs := make([]Controller, 0, len(b.mocks))
+	for _, m := range b.mocks {
+		cs = append(cs, m)
+	}
+	return cs, b.err
+}
+
+func TestBackend(t *testing.T) {
+	backends.Lock()
+	tmpNames, tmpM := backends.names, backends.m
+	backends.names, backends.m = nil, nil
+	backends.Unlock()
+	defer func() {
+		backends.Lock()
+		backends.names, backends.m = tmpNames, tmpM
+		backends.Unlock()
+	}()
+
+	t.Run("Register", func(t *testing.T) {
+		defer func() { backends.names, backends.m = nil, nil }()
+		Register("b", &mockBackend{})
+		Register("a", &mockBackend{})
+		if exp, out := []string{"b", "a"}, Backends(); !reflect.DeepEqual(exp, out) {
+			t.Fatalf("exp %v but out %v", exp, out)
+		}
+		Unregister("b")
+		Unregister("not registered")
+		if exp, out := []string{"a"}, Backends(); !reflect.DeepEqual(exp, out) {
+			t.Fatalf("exp %v but out %v", exp, out)
+		}
+		for _, f := range []func(){
+			func() { Register("a", &mockBackend{}) },
+			func() { Register("nil", nil) },
+		} {
+			func() {
+				defer func() {
+					if recover() == nil {
+						t.Error("expected panic but not")
+					}
+				}()
+				f()
+			}()
+		}
+	})
+
+	t.Run("ReadDeviceAll", func(t *testing.T) {
+		defer func() { backends.names, backends.m = nil, nil }()
+		Register("b", &mockBackend{mocks: []*mock{
+			{name: "mock2", current: 10, max: 100},
+		}})
+		Register("a", &mockBackend{mocks: []*mock{
+			{name: "mock3", current: 10, max: 100},
+			{name: "mock1", current: 10, max: 100},
+		}})
+		Register("empty", &mockBackend{})
+		devices, err := ReadDeviceAll()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var out [][2]string
+		for _, d := range devices {
+			out = append(out, [2]string{d.Name(), d.Backend()})
+		}
+		exp := [][2]string{{"mock1", "a"}, {"mock2", "b"}, {"mock3", "a"}}
+		if !reflect.DeepEqual(exp, out) {
+			t.Fatalf("exp %v but out %v", exp, out)
+		}
+
+		// duplicated across backends
+		Register("dup", &mockBackend{mocks: []*mock{
+			{name: "mock1", current: 10, max: 100},
+		}})
+		if _, err := ReadDeviceAll(); err == nil {
+			t.Fatal("expected error but nil")
+		}
+		Unregister("dup")
+
+		// error from backend
+		Register("err", &mockBackend{err: errors.New("backend error")})
+		if _, err := ReadDeviceAll(); err == nil {
+			t.Fatal("expected error but nil")
+		}
+	})
+
+	t.Run("Not Registered", func(t *testing.T) {
+		if _, err := ReadDeviceAll(); err == nil {
+			t.Fatal("expected error but nil")
+		}
+	})
+}
+
+// for Describer
+type metaMock struct {
+	mock
+	meta Metadata
+}
+
+func (m *metaMock) Metadata() (Metadata, error) { return m.meta, nil }
+
+func TestSortDevices(t *testing.T) {
+	newDevice := func(name, typ, parent, subsystem string) *Device {
+		return &Device{
+			internal: &metaMock{
+				mock: mock{name: name, current: 10, max: 100},
+				meta: Metadata{Type: typ, Parent: parent, Subsystem: subsystem},
+			},
+			max: 100,
+		}
+	}
+	devices := []*Device{
+		newDevice("acpi_video0", "firmware", "LNXVIDEO:00", "acpi"),
+		newDevice("acpi_video1", "firmware", "LNXVIDEO:01", "acpi"),
+		newDevice("tpacpi::kbd_backlight", "", "thinkpad_acpi", "platform"),
+		newDevice("dell_backlight", "platform", "dell-laptop", "platform"),
+		newDevice("intel_backlight", "raw", "0000:00:02.0", "pci"),
+		newDevice("ddcci5", "raw", "5-0037", "ddcci"),
+		newDevice("raw_without_parent", "raw", "", ""),
+	}
+
+	var tests = []struct {
+		order Order
+		exp   []string
+	}{
+		{
+			order: OrderPreferred,
+			exp: []string{
+				"intel_backlight",
+				"acpi_video0",
+				"acpi_video1",
+				"dell_backlight",
+				"ddcci5",
+				"raw_without_parent",
+				"tpacpi::kbd_backlight",
+			},
+		},
+		{
+			order: OrderName,
+			exp: []string{
+				"acpi_video0",
+				"acpi_video1",
+				"ddcci5",
+				"dell_backlight",
+				"intel_backlight",
+				"raw_without_parent",
+				"tpacpi::kbd_backlight",
+			},
+		},
+	}
+	for _, test := range tests {
+		SortDevices(devices, test.order)
+		var out []string
+		for _, d := range devices {
+			out = append(out, d.Name())
+		}
+		if !reflect.DeepEqual(test.exp, out) {
+			t.Fatalf("order %v exp %v but out %v", test.order, test.exp, out)
+		}
+	}
+}
+
+func TestReadDeviceIndexOrder(t *testing.T) {
+	tmpf := readDeviceAll
+	defer func() { readDeviceAll = tmpf }()
+	readDeviceAll = func() ([]*Device, error) {
+		return []*Device{
+			{internal: &metaMock{mock: mock{name: "acpi_video0", current: 10, max: 100}, meta: Metadata{Type: "firmware"}}},
+			{internal: &metaMock{mock: mock{name: "intel_backlight", current: 10, max: 100}, meta: Metadata{Type: "raw", Parent: "0000:00:02.0", Subsystem: "pci"}}},
+		}, nil
+	}
+	for _, test := range []struct {
+		order Order
+		exp   string
+	}{
+		{OrderPreferred, "intel_backlight"},
+		{OrderName, "acpi_video0"},
+	} {
+		d, err := ReadDeviceIndexOrder(0, test.order)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if d.Name() != test.exp {
+			t.Fatalf("order %v exp %s but out %s", test.order, test.exp, d.Name())
+		}
+	}
+	if _, err := ReadDeviceIndexOrder(2, OrderName); err == nil {
+		t.Fatal("expected error but nil")
+	}
+}
+
+func TestParseOrder(t *testing.T) {
+	for _, o := range []Order{OrderPreferred, OrderName} {
+		out, err := ParseOrder(o.String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if out != o {
+			t.Fatalf("exp %v but out %v", o, out)
+		}
+	}
+	if _, err := ParseOrder("invalid"); err == nil {
+		t.Fatal("expected error but nil")
+	}
+}
+
+// for ActualReader, the hardware clamps the brightness to limit
+type clampMock struct {
+	mock
+	limit uint
+	sets  int
+}
+
+func (m *clampMock) Set(ui uint) error { m.sets++; return m.mock.Set(ui) }
+func (m *clampMock) Actual() (uint, error) {
+	if m.current > m.limit {
+		return m.limit, nil
+	}
+	return m.current, nil
+}
+
+func TestVerify(t *testing.T) {
+	t.Run("Valid", func(t *testing.T) {
+		m := &clampMock{mock: mock{current: 10, max: 100}, limit: 100}
+		d := &Device{internal: m, max: 100}
+		d.EnableVerify(2, 0)
+		if err := d.Set(50, false); err != nil {
+			t.Fatal(err)
+		}
+		if m.sets != 1 {
+			t.Fatalf("expected set once but %d", m.sets)
+		}
+	})
+
+	t.Run("Clamped", func(t *testing.T) {
+		m := &clampMock{mock: mock{name: "clamp", current: 10, max: 100}, limit: 60}
+		d := &Device{internal: m, max: 100}
+		d.EnableVerify(2, 0)
+		err := d.SetMax()
+		verr, ok := err.(*VerifyError)
+		if !ok {
+			t.Fatalf("expected *VerifyError but %v", err)
+		}
+		if exp := (VerifyError{Name: "clamp", Want: 100, Actual: 60}); *verr != exp {
+			t.Fatalf("exp %+v but out %+v", exp, *verr)
+		}
+		if m.sets != 3 {
+			t.Fatalf("expected set 3 times but %d", m.sets)
+		}
+
+		d.DisableVerify()
+		if err := d.SetMax(); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("Fallback Current", func(t *testing.T) {
+		m := &mock{current: 10, max: 100}
+		d := &Device{internal: m, max: 100}
+		d.EnableVerify(0, 0)
+		if _, err := d.Actual(); err != ErrNotSupported {
+			t.Fatalf("expected ErrNotSupported but %v", err)
+		}
+		if err := d.SetMid(); err != nil {
+			t.Fatal(err)
+		}
+	})
+}
+
+// for PowerController
+type powerMock struct {
+	mock
+	off bool
+}
+
+func (m *powerMock) Powered() (bool, error) { return !m.off, nil }
+func (m *powerMock) SetPower(on bool) error { m.off = !on; return nil }
+
+func TestPower(t *testing.T) {
+	d := &Device{internal: &mock{current: 10, max: 100}, max: 100}
+	if _, err := d.Powered(); err != ErrNotSupported {
+		t.Fatalf("expected ErrNotSupported but %v", err)
+	}
+	if err := d.PowerOff(); err != ErrNotSupported {
+		t.Fatalf("expected ErrNotSupported but %v", err)
+	}
+
+	d = &Device{internal: &powerMock{mock: mock{current: 10, max: 100}}, max: 100}
+	for _, f := range []struct {
+		power func() error
+		exp   bool
+	}{
+		{d.PowerOff, false},
+		{d.PowerOn, true},
+	} {
+		if err := f.power(); err != nil {
+			t.Fatal(err)
+		}
+		out, err := d.Powered()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if out != f.exp {
+			t.Fatalf("want %v but out %v", f.exp, out)
+		}
+	}
+}
+
+// record all writes
+type recordMock struct {
+	mock
+	history []uint
+}
+
+func (m *recordMock) Set(ui uint) error {
+	m.history = append(m.history, ui)
+	return m.mock.Set(ui)
+}
+
+func TestFadeTo(t *testing.T) {
+	tmp := FadeInterval
+	defer func() { FadeInterval = tmp }()
+	FadeInterval = time.Millisecond
+
+	for _, easing := range []Easing{nil, Linear, EaseInOut, Exponential} {
+		for _, test := range []struct{ from, target uint }{
+			{10, 100},
+			{100, 10},
+			{50, 50},
+		} {
+			m := &recordMock{mock: mock{current: test.from, max: 100}}
+			d := &Device{internal: m, max: 100}
+			err := d.FadeTo(context.Background(), test.target, 20*time.Millisecond, easing)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if m.current != test.target {
+				t.Fatalf("want %d but out %d", test.target, m.current)
+			}
+			last := test.from
+			for _, ui := range m.history {
+				if test.from <= test.target && ui < last || test.from > test.target && ui > last {
+					t.Fatalf("not monotonic %v", m.history)
+				}
+				last = ui
+			}
+		}
+	}
+
+	t.Run("Invalid Target", func(t *testing.T) {
+		d := &Device{internal: &mock{current: 10, max: 100}, max: 100}
+		for _, target := range []uint{0, 101} {
+			if err := d.FadeTo(context.Background(), target, 0, nil); err == nil {
+				t.Fatal("expected error but nil")
+			}
+		}
+	})
+
+	t.Run("Canceled", func(t *testing.T) {
+		m := &recordMock{mock: mock{current: 10, max: 100}}
+		d := &Device{internal: m, max: 100}
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		err := d.FadeTo(ctx, 100, 20*time.Millisecond, nil)
+		if err != context.Canceled {
+			t.Fatalf("expected context.Canceled but %v", err)
+		}
+		if len(m.history) != 0 {
+			t.Fatalf("unexpected writes %v", m.history)
+		}
+	})
+
+	t.Run("Step", func(t *testing.T) {
+		// ends at the same brightness as Step
+		for _, test := range []struct {
+			current uint
+			delta   Delta
+			exp     uint
+		}{
+			{3, RawDelta(1), 4},
+			{3, RawDelta(-1), 3},
+			{10, RawDelta(-1), 10},
+			{50, PercentDelta(10), 60},
+			{100, RawDelta(1), 100},
+		} {
+			d := &Device{internal: &mock{current: test.current, max: 100}, max: 100}
+			d.SetPolicy(Policy{MinRaw: 10})
+			d.SetCurve(LinearCurve)
+			if err := d.FadeStep(context.Background(), test.delta, 5*time.Millisecond, nil); err != nil {
+				t.Fatal(err)
+			}
+			step := &Device{internal: &mock{current: test.current, max: 100}, max: 100}
+			step.SetPolicy(Policy{MinRaw: 10})
+			step.SetCurve(LinearCurve)
+			if err := step.Step(test.delta); err != nil {
+				t.Fatal(err)
+			}
+			if out, _ := d.Current(); out != test.exp || out != step.internal.(*mock).current {
+				t.Fatalf("%v from %d want %d but out %d", test.delta, test.current, test.exp, out)
+			}
+		}
+	})
+}
+
+func TestEasing(t *testing.T) {
+	for _, easing := range []Easing{Linear, EaseInOut, Exponential} {
+		if out := easing(0); math.Abs(out) > 1e-3 {
+			t.Errorf("easing(0) = %v", out)
+		}
+		if out := easing(1); math.Abs(out-1) > 1e-9 {
+			t.Errorf("easing(1) = %v", out)
+		}
+	}
+}
+
+// for Scaler
+type scaleMock struct {
+	mock
+	scale string
+}
+
+func (m *scaleMock) Scale() (string, error) { return m.scale, nil }
+
+func TestCurve(t *testing.T) {
+	gamma, err := GammaCurve(2.2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	table, err := TableCurve([][2]float64{{0, 0}, {0.5, 0.1}, {1, 1}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range []Curve{LinearCurve, gamma, CIELCurve, table} {
+		last := -1.0
+		for i := 0; i <= 100; i++ {
+			p := float64(i) / 100
+			raw := c.ToRaw(p)
+			if raw < last {
+				t.Fatalf("%T not monotonic at %v", c, p)
+			}
+			last = raw
+			if out := c.FromRaw(raw); math.Abs(out-p) > 1e-9 {
+				t.Fatalf("%T round trip %v != %v", c, p, out)
+			}
+		}
+	}
+	if out := table.ToRaw(0.75); math.Abs(out-0.55) > 1e-9 {
+		t.Fatalf("table.ToRaw(0.75) = %v", out)
+	}
+
+	t.Run("Invalid", func(t *testing.T) {
+		if _, err := GammaCurve(0); err == nil {
+			t.Fatal("expected error but nil")
+		}
+		for _, points := range [][][2]float64{
+			nil,
+			{{0, 0}},
+			{{0.1, 0}, {1, 1}},
+			{{0, 0}, {0.9, 1}},
+			{{0, 0}, {0.5, 0.5}, {0.5, 0.6}, {1, 1}},
+			{{0, 0}, {0.5, 0.6}, {0.6, 0.5}, {1, 1}},
+			{{0, 0}, {1, 2}},
+		} {
+			if _, err := TableCurve(points); err == nil {
+				t.Fatalf("expected error but nil %v", points)
+			}
+		}
+	})
+
+	t.Run("Default", func(t *testing.T) {
+		for _, test := range []struct {
+			internal Controller
+			exp      Curve
+		}{
+			{&mock{max: 100}, LinearCurve},
+			{&scaleMock{mock: mock{max: 100}, scale: "linear"}, CIELCurve},
+			{&scaleMock{mock: mock{max: 100}, scale: "non-linear"}, LinearCurve},
+			{&scaleMock{mock: mock{max: 100}, scale: "unknown"}, LinearCurve},
+		} {
+			d := &Device{internal: test.internal, max: 100}
+			if out := d.Curve(); out != test.exp {
+				t.Fatalf("exp %T but out %T", test.exp, out)
+			}
+		}
+		d := &Device{internal: &mock{max: 100}, max: 100}
+		d.SetCurve(gamma)
+		if d.Curve() != gamma {
+			t.Fatal("curve is not changed")
+		}
+		d.SetCurve(nil)
+		if d.Curve() != LinearCurve {
+			t.Fatal("curve is not reset")
+		}
+	})
+
+	t.Run("Steps", func(t *testing.T) {
+		m := &mock{current: 10, max: 1000}
+		d := &Device{internal: m, max: 1000}
+		d.SetCurve(CIELCurve)
+		history := []uint{m.current}
+		for i := 0; i < 20; i++ {
+			if err := d.Inc10Percent(); err != nil {
+				t.Fatal(err)
+			}
+			history = append(history, m.current)
+		}
+		if m.current != 1000 {
+			t.Fatalf("not reached to max %v", history)
+		}
+		// perceptual steps are fine at the low end
+		if history[1]-history[0] >= 100 {
+			t.Fatalf("coarse step at the low end %v", history)
+		}
+		for i := 0; i < 20; i++ {
+			if err := d.Dec10Percent(); err != nil {
+				t.Fatal(err)
+			}
+			history = append(history, m.current)
+		}
+		if m.current != 100 {
+			t.Fatalf("not reached to the limit %v", history)
+		}
+	})
+}
+
+func TestPercent(t *testing.T) {
+	gamma, err := GammaCurve(2.2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, max := range []uint{1, 7, 100, 255, 120000} {
+		for _, curve := range []Curve{LinearCurve, CIELCurve, gamma} {
+			m := &mock{current: max, max: max}
+			d := &Device{internal: m, max: max}
+			d.SetCurve(curve)
+			for i := 0; i <= 100; i++ {
+				// SetPercent -> Percent -> SetPercent keeps the raw brightness
+				if err := d.SetPercent(float64(i), WithForce()); err != nil {
+					t.Fatal(err)
+				}
+				raw := m.current
+				p, err := d.Percent()
+				if err != nil {
+					t.Fatal(err)
+				}
+				if p < 0 || p > 100 {
+					t.Fatalf("percentage out of range %v", p)
+				}
+				if err := d.SetPercent(p, WithForce()); err != nil {
+					t.Fatal(err)
+				}
+				if m.current != raw {
+					t.Fatalf("max %d curve %T: %d%% round trip %d -> %v -> %d",
+						max, curve, i, raw, p, m.current)
+				}
+			}
+		}
+	}
+
+	t.Run("Rounding", func(t *testing.T) {
+		d := &Device{internal: &mock{current: 7, max: 7}, max: 7}
+		for _, test := range []struct {
+			p        float64
+			rounding Rounding
+			exp      uint
+		}{
+			{50, RoundNearest, 4},
+			{50, RoundUp, 4},
+			{50, RoundDown, 3},
+			{100.0 / 7 * 3, RoundUp, 3},
+			{100.0 / 7 * 3, RoundDown, 3},
+			{0, RoundUp, 0},
+			{100, RoundNearest, 7},
+		} {
+			if out := d.RawOf(test.p, test.rounding); out != test.exp {
+				t.Fatalf("RawOf(%v, %v) exp %d but out %d", test.p, test.rounding, test.exp, out)
+			}
+		}
+	})
+
+	t.Run("Invalid", func(t *testing.T) {
+		m := &mock{current: 50, max: 100}
+		d := &Device{internal: m, max: 100}
+		for _, p := range []float64{-1, 101, math.NaN(), 0, 5} {
+			if err := d.SetPercent(p); err == nil {
+				t.Fatalf("expected error but nil %v", p)
+			}
+		}
+		if m.current != 50 {
+			t.Fatalf("brightness is changed to %d", m.current)
+		}
+	})
+}
+
+var stepTests = []struct {
+	current, max uint
+	delta        Delta
+	want         uint
+}{
+	{50, 100, PercentDelta(5), 55},
+	{50, 100, PercentDelta(-2), 48},
+	{50, 100, PercentDelta(0.1), 51},
+	{50, 100, PercentDelta(0), 50},
+	{98, 100, PercentDelta(5), 100},
+	{12, 100, PercentDelta(-5), 10},
+	{9, 100, PercentDelta(-5), 9},
+
+	{50, 100, RawDelta(3), 53},
+	{50, 100, RawDelta(-3), 47},
+	{11, 100, RawDelta(-3), 10},
+	{99, 100, RawDelta(3), 100},
+
+	// small max
+	{3, 7, PercentDelta(2), 4},
+	{3, 7, PercentDelta(-2), 2},
+	{1, 7, PercentDelta(-50), 1},
+	{3, 7, PercentDelta(50), 6},
+	{3, 7, RawDelta(10), 7},
+
+	// large max
+	{60000, 120000, PercentDelta(2), 62400},
+	{60000, 120000, RawDelta(-1), 59999},
+	{12500, 120000, PercentDelta(-5), 12000},
+}
+
+func TestStep(t *testing.T) {
+	for _, test := range stepTests {
+		m := &mock{current: test.current, max: test.max}
+		d := &Device{internal: m, max: test.max}
+		if err := d.Step(test.delta); err != nil {
+			t.Fatal(err)
+		}
+		if m.current != test.want {
+			t.Fatalf("case %+v out %d", test, m.current)
+		}
+	}
+
+	t.Run("Perceptual", func(t *testing.T) {
+		m := &mock{current: 500, max: 1000}
+		d := &Device{internal: m, max: 1000}
+		d.SetCurve(CIELCurve)
+		for _, delta := range []Delta{PercentDelta(2), PercentDelta(-2)} {
+			before := m.current
+			want, err := d.StepValue(delta)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := d.Step(delta); err != nil {
+				t.Fatal(err)
+			}
+			if m.current != want {
+				t.Fatalf("StepValue %d but Step %d", want, m.current)
+			}
+			if delta.Value > 0 && m.current <= before || delta.Value < 0 && m.current >= before {
+				t.Fatalf("step %v from %d to %d", delta, before, m.current)
+			}
+		}
+	})
+}
+
+func TestParseDelta(t *testing.T) {
+	for _, test := range []struct {
+		s       string
+		exp     Delta
+		wanterr bool
+	}{
+		{s: "5", exp: PercentDelta(5)},
+		{s: "2%", exp: PercentDelta(2)},
+		{s: "-2.5%", exp: PercentDelta(-2.5)},
+		{s: "raw:3", exp: RawDelta(3)},
+		{s: "raw:-3", exp: RawDelta(-3)},
+		{s: "", wanterr: true},
+		{s: "raw:", wanterr: true},
+		{s: "raw:1.5", wanterr: true},
+		{s: "NaN", wanterr: true},
+		{s: "five", wanterr: true},
+	} {
+		out, err := ParseDelta(test.s)
+		if test.wanterr {
+			if err == nil {
+				t.Fatalf("%q expected error but nil", test.s)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if out != test.exp {
+			t.Fatalf("%q exp %+v but out %+v", test.s, test.exp, out)
+		}
+		if back, err := ParseDelta(out.String()); err != nil || back != out {
+			t.Fatalf("%q String() round trip %v %v", test.s, back, err)
+		}
+	}
+}
+
+func TestPolicy(t *testing.T) {
+	for _, test := range []struct {
+		policy   Policy
+		max      uint
+		min, cap uint
+	}{
+		{DefaultPolicy(), 100, 10, 100},
+		{DefaultPolicy(), 9, 1, 9},
+		{DefaultPolicy(), 120000, 12000, 120000},
+		{NoPolicy(), 100, 0, 100},
+		{Policy{}, 100, 1, 100},
+		{Policy{MinRaw: 20, MinPercent: 5}, 100, 20, 100},
+		{Policy{MinRaw: 2, MinPercent: 5}, 100, 5, 100},
+		{Policy{MinRaw: 200}, 100, 100, 100},
+		{Policy{MaxRaw: 80, MaxPercent: 90}, 100, 1, 80},
+		{Policy{MaxRaw: 95, MaxPercent: 90}, 100, 1, 90},
+		{Policy{MinRaw: 50, MaxRaw: 40}, 100, 50, 50},
+	} {
+		d := &Device{internal: &mock{max: test.max}, max: test.max}
+		d.SetPolicy(test.policy)
+		if min, cap := d.Min(), d.Cap(); min != test.min || cap != test.cap {
+			t.Fatalf("policy %+v max %d: exp [%d, %d] but out [%d, %d]",
+				test.policy, test.max, test.min, test.cap, min, cap)
+		}
+	}
+
+	t.Run("Respected", func(t *testing.T) {
+		m := &mock{current: 50, max: 100}
+		d := &Device{internal: m, max: 100}
+		d.SetPolicy(Policy{MinRaw: 20, MaxPercent: 80, AllowZero: true})
+
+		for _, want := range []uint{19, 81, 101} {
+			if err := d.Set(want, false); err == nil {
+				t.Fatalf("Set(%d) expected error but nil", want)
+			}
+		}
+		if err := d.Set(90, true); err != nil {
+			t.Fatal(err)
+		}
+		for _, test := range []struct {
+			f   func() error
+			exp uint
+		}{
+			{func() error { return d.Set(0, false) }, 0},
+			{d.SetMax, 80},
+			{d.SetMin, 20},
+			{d.SetMid, 50},
+			{func() error { return d.Step(PercentDelta(50)) }, 80},
+			{func() error { return d.Step(RawDelta(-100)) }, 20},
+			{func() error { return d.SetPercent(80) }, 80},
+			// over the cap by force is not darkened by the increment
+			{func() error { return d.Set(90, true) }, 90},
+			{func() error { return d.Step(PercentDelta(10)) }, 90},
+			{func() error { return d.Step(RawDelta(-1)) }, 89},
+		} {
+			if err := test.f(); err != nil {
+				t.Fatal(err)
+			}
+			if m.current != test.exp {
+				t.Fatalf("exp %d but out %d", test.exp, m.current)
+			}
+		}
+		if err := d.SetPercent(100); err == nil {
+			t.Fatal("expected error but nil")
+		}
+		if err := d.FadeTo(context.Background(), 90, 0, nil); err == nil {
+			t.Fatal("expected error but nil")
+		}
+	})
+}
+
+func TestSnapshot(t *testing.T) {
+	newDevice := func(name, path string, current, max uint) (*Device, *metaMock) {
+		m := &metaMock{
+			mock: mock{name: name, current: current, max: max},
+			meta: Metadata{Path: path},
+		}
+		return &Device{internal: m, backend: "mock", max: max}, m
+	}
+	d1, _ := newDevice("a", "/sys/devices/a", 30, 100)
+	d2, _ := newDevice("b", "", 7, 7)
+	s, err := TakeSnapshot(d1, d2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if _, err := s.WriteTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+	s, err = ReadSnapshot(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	exp := &Snapshot{Devices: []DeviceState{
+		{Name: "a", Backend: "mock", Path: "/sys/devices/a", Current: 30, Max: 100},
+		{Name: "b", Backend: "mock", Current: 7, Max: 7},
+	}}
+	if !reflect.DeepEqual(exp, s) {
+		t.Fatalf("exp %+v but out %+v", exp, s)
+	}
+
+	// renamed but same path, max is changed, and not matched
+	r1, m1 := newDevice("renamed", "/sys/devices/a", 100, 1000)
+	r2, m2 := newDevice("b", "", 1, 7)
+	r3, m3 := newDevice("c", "", 5, 10)
+	if err := s.Restore(r3, r2, r1); err != nil {
+		t.Fatal(err)
+	}
+	for _, test := range []struct {
+		m   *metaMock
+		exp uint
+	}{
+		{m1, 300},
+		{m2, 7},
+		{m3, 5},
+	} {
+		if test.m.current != test.exp {
+			t.Fatalf("%s exp %d but out %d", test.m.name, test.exp, test.m.current)
+		}
+	}
+}
+
+// changed by others while watching
+type watchMock struct {
+	sync.Mutex
+	mock
+}
+
+func (m *watchMock) Current() (uint, error) {
+	m.Lock()
+	defer m.Unlock()
+	return m.mock.Current()
+}
+
+func (m *watchMock) Set(ui uint) error {
+	m.Lock()
+	defer m.Unlock()
+	return m.mock.Set(ui)
+}
+
+func TestWatch(t *testing.T) {
+	tmp := WatchInterval
+	defer func() { WatchInterval = tmp }()
+	WatchInterval = time.Millisecond
+
+	m := &watchMock{mock: mock{current: 50, max: 100}}
+	d := &Device{internal: m, max: 100}
+	ctx, cancel := context.WithCancel(context.Background())
+	ch := d.Watch(ctx)
+
+	for _, exp := range []Change{{Old: 50, New: 60}, {Old: 60, New: 10}} {
+		m.Set(exp.New)
+		select {
+		case c := <-ch:
+			if c.Old != exp.Old || c.New != exp.New || c.Source != SourceSoftware {
+				t.Fatalf("want %+v but out %+v", exp, c)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("timeout")
+		}
+	}
+
+	cancel()
+	for c := range ch {
+		t.Fatalf("unexpected change %+v", c)
+	}
+}
+
+// changed by the hardware while watching
+type hwMock struct {
+	watchMock
+	hw    uint
+	hwErr error
+}
+
+func (m *hwMock) HardwareChanged() (uint, error) {
+	m.Lock()
+	defer m.Unlock()
+	return m.hw, m.hwErr
+}
+
+// change by the hardware if hw is true
+func (m *hwMock) change(ui uint, hw bool) {
+	m.Lock()
+	defer m.Unlock()
+	m.current = ui
+	if hw {
+		m.hw, m.hwErr = ui, nil
+	}
+}
+
+func TestHardwareChanged(t *testing.T) {
+	tmp := WatchInterval
+	defer func() { WatchInterval = tmp }()
+	WatchInterval = time.Millisecond
+
+	d := &Device{internal: &mock{current: 50, max: 100}, max: 100}
+	if _, err := d.HardwareChanged(); err != ErrNotSupported {
+		t.Fatalf("expected ErrNotSupported but %v", err)
+	}
+
+	m := &hwMock{watchMock: watchMock{mock: mock{current: 50, max: 100}}, hwErr: ErrNoHardwareChange}
+	d = &Device{internal: m, max: 100}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ch := d.Watch(ctx)
+
+	for _, test := range []struct {
+		value uint
+		hw    bool
+	}{
+		{60, true},
+		{70, false},
+		{20, true},
+		{80, true},
+		{90, false},
+	} {
+		m.change(test.value, test.hw)
+		exp := SourceSoftware
+		if test.hw {
+			exp = SourceHardware
+		}
+		select {
+		case c := <-ch:
+			if c.New != test.value || c.Source != exp {
+				t.Fatalf("want %d by %v but out %+v", test.value, exp, c)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("timeout")
+		}
+	}
+	if out, err := d.HardwareChanged(); err != nil || out != 80 {
+		t.Fatalf("want 80 but out %d %v", out, err)
+	}
+}
+
+func TestLuxCurve(t *testing.T) {
+	for _, points := range [][][2]float64{
+		nil,
+		{{-1, 10}},
+		{{0, 10}, {0, 20}},
+		{{10, 10}, {0, 20}},
+		{{0, 20}, {10, 10}},
+		{{0, 101}},
+		{{0, -1}},
+		{{math.NaN(), 10}},
+	} {
+		if _, err := NewLuxCurve(points); err == nil {
+			t.Fatalf("%v expected error but nil", points)
+		}
+	}
+
+	c, err := ParseLuxCurve("0:10, 9:50%,99:50,999:100")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, test := range []struct{ lux, exp float64 }{
+		{-1, 10},
+		{0, 10},
+		{2, 10 + 40*math.Log1p(2)/math.Log1p(9)}, // interpolated in log1p
+		{9, 50},
+		{50, 50},
+		{999, 100},
+		{100000, 100},
+	} {
+		if out := c.Percent(test.lux); math.Abs(out-test.exp) > 1e-9 {
+			t.Fatalf("lux %v want %v but out %v", test.lux, test.exp, out)
+		}
+	}
+	if out := c.String(); out != "0:10,9:50,99:50,999:100" {
+		t.Fatalf("unexpected string %s", out)
+	}
+	for _, s := range []string{"", "0", "0:x", "x:0", "0:10,"} {
+		if _, err := ParseLuxCurve(s); err == nil {
+			t.Fatalf("%q expected error but nil", s)
+		}
+	}
+	// monotonic
+	d := DefaultLuxCurve()
+	last := 0.0
+	for lux := 0.0; lux < 20000; lux += 7 {
+		p := d.Percent(lux)
+		if p < last {
+			t.Fatalf("not monotonic at %v", lux)
+		}
+		last = p
+	}
+}
+
+// replay the lux
+type luxTrace []float64
+
+func (t *luxTrace) Lux() (float64, error) {
+	if len(*t) == 0 {
+		return 0, errors.New("end of trace")
+	}
+	lux := (*t)[0]
+	*t = (*t)[1:]
+	return lux, nil
+}
+
+func TestAutoController(t *testing.T) {
+	// percent is raw on the linear device of max 100
+	curve, err := NewLuxCurve([][2]float64{{0, 10}, {1000, 100}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Unix(0, 0)
+
+	for _, test := range []struct {
+		name       string
+		smoothing  time.Duration
+		hysteresis float64
+		rate       float64
+		trace      luxTrace
+		exp        []uint
+	}{
+		{
+			name:  "Follow",
+			trace: luxTrace{0, 1000, 1000, 0},
+			exp:   []uint{10, 100, 100, 10},
+		},
+		{
+			name:       "Hysteresis",
+			hysteresis: 5,
+			// 10 lux is about 41%, 12 lux is about 43%, 20 lux is about 50%
+			trace: luxTrace{10, 12, 10, 12, 20},
+			exp:   []uint{41, 41, 41, 41, 50},
+		},
+		{
+			name:  "Max Rate",
+			rate:  20,
+			trace: luxTrace{1000, 1000, 1000, 1000, 1000, 0},
+			exp:   []uint{70, 90, 100, 100, 100, 80},
+		},
+		{
+			name:      "Smoothing",
+			smoothing: time.Hour,
+			// the short spike is damped
+			trace: luxTrace{0, 1000, 0, 0},
+			exp:   []uint{10, 13, 13, 13},
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			m := &mock{current: 50, max: 100}
+			d := &Device{internal: m, max: 100}
+			d.SetCurve(LinearCurve)
+			trace := test.trace
+			a := NewAutoController(d, &trace)
+			a.Curve = curve
+			a.Smoothing = test.smoothing
+			a.Hysteresis = test.hysteresis
+			a.MaxRate = test.rate
+			for i, exp := range test.exp {
+				out, err := a.Update(start.Add(time.Duration(i) * a.Interval))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if out != exp {
+					t.Fatalf("[%d] want %d but out %d", i, exp, out)
+				}
+				m.current = out
+			}
+			if _, err := a.Update(start); err == nil {
+				t.Fatal("expected error but nil")
+			}
+		})
+	}
+
+	t.Run("Limited", func(t *testing.T) {
+		d := &Device{internal: &mock{current: 50, max: 100}, max: 100}
+		d.SetPolicy(Policy{MinPercent: 20, MaxPercent: 90})
+		d.SetCurve(LinearCurve)
+		trace := luxTrace{0, 1000}
+		a := NewAutoController(d, &trace)
+		a.Curve = curve
+		a.Smoothing, a.MaxRate = 0, 0
+		for _, exp := range []uint{20, 90} {
+			if out, err := a.Update(start); err != nil || out != exp {
+				t.Fatalf("want %d but out %d %v", exp, out, err)
+			}
+		}
+	})
+
+	t.Run("Run", func(t *testing.T) {
+		tmp := FadeInterval
+		defer func() { FadeInterval = tmp }()
+		FadeInterval = time.Millisecond
+
+		m := &recordMock{mock: mock{current: 50, max: 100}}
+		d := &Device{internal: m, max: 100}
+		d.SetCurve(LinearCurve)
+		trace := luxTrace{1000, 1000, 1000}
+		a := NewAutoController(d, &trace)
+		a.Curve = curve
+		a.Smoothing, a.MaxRate = 0, 0
+		a.Interval, a.Fade = 5*time.Millisecond, 10*time.Millisecond
+		// stopped by the end of trace
+		if err := a.Run(context.Background()); err == nil {
+			t.Fatal("expected error but nil")
+		}
+		// the steps of the fade depend on the scheduling, only the end is checked
+		if m.current != 100 {
+			t.Fatalf("unexpected writes %v", m.history)
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		trace = luxTrace{0}
+		if err := a.Run(ctx); err != context.Canceled {
+			t.Fatalf("expected context.Canceled but %v", err)
+		}
+	})
+}
+
+func TestLuxModel(t *testing.T) {
+	tmp := MaxLuxSamples
+	defer func() { MaxLuxSamples = tmp }()
+	MaxLuxSamples = 3
+
+	base, err := NewLuxCurve([][2]float64{{0, 10}, {100, 50}, {1000, 80}, {10000, 100}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := &LuxModel{Base: base}
+	m.Add(1000, 30)
+	// the same lighting is replaced
+	m.Add(1100, 35)
+	if !reflect.DeepEqual(m.Samples, [][2]float64{{1100, 35}}) {
+		t.Fatalf("unexpected samples %v", m.Samples)
+	}
+	c, err := m.Fit()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the base points are kept under the sample
+	exp := [][2]float64{{0, 10}, {100, 35}, {1100, 35}, {10000, 100}}
+	if out := c.Points(); !reflect.DeepEqual(out, exp) {
+		t.Fatalf("want %v but out %v", exp, out)
+	}
+	if out := c.Percent(1100); out != 35 {
+		t.Fatalf("want 35 but out %v", out)
+	}
+
+	// the conflicting samples are averaged
+	m.Add(10, 60)
+	c, err = m.Fit()
+	if err != nil {
+		t.Fatal(err)
+	}
+	exp = [][2]float64{{0, 10}, {10, 47.5}, {100, 47.5}, {1100, 47.5}, {10000, 100}}
+	if out := c.Points(); !reflect.DeepEqual(out, exp) {
+		t.Fatalf("want %v but out %v", exp, out)
+	}
+
+	// the oldest is dropped
+	m.Add(5000, 90)
+	m.Add(0, 5)
+	if !reflect.DeepEqual(m.Samples, [][2]float64{{10, 60}, {5000, 90}, {0, 5}}) {
+		t.Fatalf("unexpected samples %v", m.Samples)
+	}
+
+	// monotonic for any samples
+	m = &LuxModel{}
+	for i, lux := range []float64{3, 3000, 30, 300, 0.3, 30000} {
+		m.Add(lux, float64(100-i*15))
+		c, err := m.Fit()
+		if err != nil {
+			t.Fatal(err)
+		}
+		points := c.Points()
+		for j := 1; j < len(points); j++ {
+			if points[j][1] < points[j-1][1] {
+				t.Fatalf("not monotonic %v", points)
+			}
+		}
+	}
+}
+
+func TestLearn(t *testing.T) {
+	m := &mock{name: "mock", current: 50, max: 100}
+	d := &Device{internal: m, max: 100}
+	d.SetCurve(LinearCurve)
+	trace := luxTrace{100, 100, 100, 100, 1000}
+	a := NewAutoController(d, &trace)
+	a.Smoothing, a.MaxRate = 0, 0
+	if err := a.Learn(20); err == nil {
+		t.Fatal("expected error before Update but nil")
+	}
+	if out, err := a.Update(time.Unix(0, 0)); err != nil || out != 50 {
+		t.Fatalf("want 50 but out %d %v", out, err)
+	}
+
+	dir, err := ioutil.TempDir("", "TestLearn")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	p := &Persister{Dir: dir}
+	if _, err := p.LoadLuxModel(d); !os.IsNotExist(err) {
+		t.Fatalf("expected not exist but %v", err)
+	}
+	a.OnLearn = func(m *LuxModel) error { return p.SaveLuxModel(d, m) }
+
+	// the user chose 20 in 100 lux
+	m.current = 20
+	if err := a.Learn(20); err != nil {
+		t.Fatal(err)
+	}
+	for _, exp := range []uint{20, 20} {
+		if out, err := a.Update(time.Unix(1, 0)); err != nil || out != exp {
+			t.Fatalf("want %d but out %d %v", exp, out, err)
+		}
+	}
+
+	model, err := p.LoadLuxModel(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(model, a.Model) {
+		t.Fatalf("want %+v but out %+v", a.Model, model)
+	}
+	c, err := model.Fit()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(c, a.Curve) {
+		t.Fatalf("want %v but out %v", a.Curve, c)
+	}
+}
+
+// constant lux
+type luxConst float64
+
+func (l luxConst) Lux() (float64, error) { return float64(l), nil }
+
+func TestLearnRun(t *testing.T) {
+	m := &watchMock{mock: mock{current: 50, max: 100}}
+	d := &Device{internal: m, max: 100}
+	d.SetCurve(LinearCurve)
+	a := NewAutoController(d, luxConst(100))
+	a.Smoothing, a.MaxRate = 0, 0
+	a.Interval, a.Fade = 5*time.Millisecond, 0
+	a.Model = &LuxModel{}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	learned := make(chan [][2]float64, 1)
+	a.OnLearn = func(m *LuxModel) error {
+		learned <- m.Samples
+		cancel()
+		return nil
+	}
+	done := make(chan error, 1)
+	go func() { done <- a.Run(ctx) }()
+
+	// changed by others e.g. akari -inc
+	time.Sleep(20 * time.Millisecond)
+	m.Set(30)
+	select {
+	case samples := <-learned:
+		if !reflect.DeepEqual(samples, [][2]float64{{100, 30}}) {
+			t.Fatalf("unexpected samples %v", samples)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout")
+	}
+	if err := <-done; err != context.Canceled {
+		t.Fatalf("expected context.Canceled but %v", err)
+	}
+}
+
+func TestReadLuxTrace(t *testing.T) {
+	for _, test := range []struct {
+		in  string
+		exp []LuxSample
+	}{
+		{"time,lux\n0,10\n1.5,20\n", []LuxSample{{0, 10}, {1500 * time.Millisecond, 20}}},
+		{"# comment\n10, 5\n12, 6\n", []LuxSample{{0, 5}, {2 * time.Second, 6}}},
+		{"2021-01-01T07:00:00Z,1\n2021-01-01T07:01:00Z,2\n", []LuxSample{{0, 1}, {time.Minute, 2}}},
+	} {
+		out, err := ReadLuxTrace(strings.NewReader(test.in))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(out, test.exp) {
+			t.Fatalf("want %v but out %v", test.exp, out)
+		}
+	}
+	for _, in := range []string{"", "time,lux\n", "0\n", "0,10\n1,x\n", "x,10\n1,10\n1,10\nx,10\n", "1,10\n0,10\n"} {
+		if _, err := ReadLuxTrace(strings.NewReader(in)); err == nil {
+			t.Fatalf("%q expected error but nil", in)
+		}
+	}
+}
+
+func TestSimulate(t *testing.T) {
+	if _, err := NewMemoryDevice("sim", 1, 0); err == nil {
+		t.Fatal("expected error but nil")
+	}
+	if _, err := NewMemoryDevice("sim", 2, 1); err == nil {
+		t.Fatal("expected error but nil")
+	}
+
+	curve, err := NewLuxCurve([][2]float64{{0, 10}, {1000, 100}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// dark room, flickering shadow at 10s, bright at 20s
+	var trace []LuxSample
+	for i := 0; i <= 40; i++ {
+		lux := 10.0
+		switch {
+		case i >= 20:
+			lux = 1000
+		case i >= 10 && i%2 == 1:
+			lux = 12
+		}
+		trace = append(trace, LuxSample{Time: time.Duration(i) * time.Second, Lux: lux})
+	}
+
+	simulate := func(configure func(a *AutoController)) *SimulationResult {
+		t.Helper()
+		d, err := NewMemoryDevice("sim", 41, 100)
+		if err != nil {
+			t.Fatal(err)
+		}
+		a := NewAutoController(d, nil)
+		a.Curve = curve
+		a.Smoothing, a.Hysteresis, a.MaxRate = 0, 0, 0
+		configure(a)
+		result, err := a.Simulate(trace)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(result.Timeline) != 41 {
+			t.Fatalf("unexpected timeline %v", result.Timeline)
+		}
+		// within the hysteresis
+		if last := result.Timeline[40]; last.Lux != 1000 || last.Brightness < 95 || last.Percent != float64(last.Brightness) {
+			t.Fatalf("unexpected last step %+v", last)
+		}
+		return result
+	}
+
+	plain := simulate(func(a *AutoController) {})
+	// every flicker is followed
+	if plain.Writes != 10 || math.Abs(plain.MaxJump-57) > 1e-9 || plain.Settle != 0 {
+		t.Fatalf("unexpected result %+v", plain)
+	}
+
+	hysteresis := simulate(func(a *AutoController) { a.Hysteresis = 5 })
+	if hysteresis.Writes != 1 || math.Abs(hysteresis.MaxJump-59) > 1e-9 {
+		t.Fatalf("unexpected result %+v", hysteresis)
+	}
+
+	rate := simulate(func(a *AutoController) { a.Hysteresis, a.MaxRate = 5, 10 })
+	// 59% by 10% per second
+	if rate.Writes != 6 || math.Abs(rate.MaxJump-10) > 1e-9 || rate.Settle != 5*time.Second {
+		t.Fatalf("unexpected result %+v", rate)
+	}
+
+	smoothing := simulate(func(a *AutoController) { a.Hysteresis, a.Smoothing = 5, 2*time.Second })
+	if smoothing.MaxJump >= hysteresis.MaxJump || smoothing.Settle <= 0 {
+		t.Fatalf("unexpected result %+v", smoothing)
+	}
+
+	d, err := NewMemoryDevice("sim", 50, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewAutoController(d, nil).Simulate(nil); err == nil {
+		t.Fatal("expected error but nil")
+	}
+}
+
+func TestSun(t *testing.T) {
+	location := func(name string) *time.Location {
+		loc, err := time.LoadLocation(name)
+		if err != nil {
+			t.Skip(err)
+		}
+		return loc
+	}
+	for _, test := range []struct {
+		name              string
+		lat, lon          float64
+		date              time.Time
+		sunrise, sunset   string
+		dawn, dusk        string // "*" is any time
+		polarDay, polarNt bool
+	}{
+		{"Tokyo", 35.6895, 139.6917, time.Date(2021, 6, 21, 0, 0, 0, 0, location("Asia/Tokyo")), "04:25", "19:00", "03:55", "19:30", false, false},
+		{"London", 51.5074, -0.1278, time.Date(2021, 12, 21, 23, 0, 0, 0, location("Europe/London")), "08:04", "15:53", "07:24", "16:33", false, false},
+		{"Sydney", -33.8688, 151.2093, time.Date(2021, 6, 21, 12, 0, 0, 0, location("Australia/Sydney")), "07:00", "16:54", "06:33", "17:21", false, false},
+		{"Tromso Winter", 69.6492, 18.9553, time.Date(2021, 12, 21, 12, 0, 0, 0, location("Europe/Oslo")), "", "", "*", "*", false, true},
+		{"Tromso Summer", 69.6492, 18.9553, time.Date(2021, 6, 21, 12, 0, 0, 0, location("Europe/Oslo")), "", "", "", "", true, false},
+	} {
+		s, err := Sun(test.date, test.lat, test.lon)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if s.PolarDay != test.polarDay || s.PolarNight != test.polarNt {
+			t.Fatalf("%s unexpected polar %+v", test.name, s)
+		}
+		for _, e := range []struct {
+			event SunEvent
+			exp   string
+		}{
+			{Sunrise, test.sunrise},
+			{Sunset, test.sunset},
+			{Dawn, test.dawn},
+			{Dusk, test.dusk},
+		} {
+			out := s.Time(e.event)
+			switch e.exp {
+			case "":
+				if !out.IsZero() {
+					t.Fatalf("%s %v want zero but out %v", test.name, e.event, out)
+				}
+				continue
+			case "*":
+				// only the twilight around the noon
+				if out.IsZero() || out.Sub(s.Noon) > 4*time.Hour || s.Noon.Sub(out) > 4*time.Hour {
+					t.Fatalf("%s %v unexpected %v noon %v", test.name, e.event, out, s.Noon)
+				}
+				continue
+			}
+			exp, err := time.ParseInLocation("2006-01-02 15:04", test.date.Format("2006-01-02 ")+e.exp, test.date.Location())
+			if err != nil {
+				t.Fatal(err)
+			}
+			// a few minutes error
+			if diff := out.Sub(exp); diff < -3*time.Minute || diff > 3*time.Minute {
+				t.Fatalf("%s %v want %v but out %v", test.name, e.event, exp, out)
+			}
+		}
+	}
+	for _, ll := range [][2]float64{{91, 0}, {-91, 0}, {0, 181}, {0, -181}, {math.NaN(), 0}} {
+		if _, err := Sun(time.Now(), ll[0], ll[1]); err == nil {
+			t.Fatalf("%v expected error but nil", ll)
+		}
+	}
+}
+
+func TestParseWindow(t *testing.T) {
+	for _, test := range []struct {
+		in  string
+		exp Window
+	}{
+		{"dawn..sunrise", Window{From: Dawn, To: Sunrise}},
+		{"sunset-30m..dusk+1h", Window{From: Sunset, FromOffset: -30 * time.Minute, To: Dusk, ToOffset: time.Hour}},
+		{"noon..noon+1m", Window{From: Noon, To: Noon, ToOffset: time.Minute}},
+	} {
+		out, err := ParseWindow(test.in)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if out != test.exp {
+			t.Fatalf("want %+v but out %+v", test.exp, out)
+		}
+		if again, err := ParseWindow(out.String()); err != nil || again != out {
+			t.Fatalf("round trip of %s failed %+v %v", out, again, err)
+		}
+	}
+	for _, in := range []string{"", "dawn", "dawn..", "x..dusk", "dawn+x..dusk", "dawn..dusk..noon"} {
+		if _, err := ParseWindow(in); err == nil {
+			t.Fatalf("%q expected error but nil", in)
+		}
+	}
+}
+
+// advance the time only by After
+type fakeClock struct {
+	sync.Mutex
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.Lock()
+	defer c.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) After(d time.Duration) <-chan time.Time {
+	c.Lock()
+	defer c.Unlock()
+	c.now = c.now.Add(d)
+	ch := make(chan time.Time, 1)
+	ch <- c.now
+	return ch
+}
+
+func TestSchedule(t *testing.T) {
+	if _, err := NewSchedule(100, 0); err == nil {
+		t.Fatal("expected error but nil")
+	}
+	// the equator on the equinox in UTC, the sun rises about 6:00 and sets about 18:00
+	s, err := NewSchedule(0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Day, s.Night = 100, 20
+	s.Morning = Window{From: Sunrise, FromOffset: -time.Hour, To: Sunrise, ToOffset: time.Hour}
+	s.Evening = Window{From: Sunset, To: Sunset, ToOffset: 2 * time.Hour}
+	day := time.Date(2021, 3, 20, 0, 0, 0, 0, time.UTC)
+	sun, err := Sun(day, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, test := range []struct {
+		at  time.Time
+		exp float64
+	}{
+		{day, 20},
+		{sun.Sunrise.Add(-time.Hour), 20},
+		{sun.Sunrise, 60},
+		{sun.Sunrise.Add(time.Hour), 100},
+		{sun.Noon, 100},
+		{sun.Sunset, 100},
+		{sun.Sunset.Add(30 * time.Minute), 80},
+		{sun.Sunset.Add(2 * time.Hour), 20},
+		{day.Add(23 * time.Hour), 20},
+	} {
+		out, err := s.Percent(test.at)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if math.Abs(out-test.exp) > 1e-9 {
+			t.Fatalf("%v want %v but out %v", test.at, test.exp, out)
+		}
+	}
+
+	// the morning in Tokyo is the evening in UTC
+	s.Latitude, s.Longitude = 35.6895, 139.6917
+	sun, err = Sun(time.Date(2021, 6, 21, 0, 0, 0, 0, time.FixedZone("JST", 9*60*60)), s.Latitude, s.Longitude)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, test := range []struct {
+		at  time.Time
+		exp float64
+	}{
+		{sun.Sunrise.Add(2 * time.Hour).UTC(), 100},
+		{sun.Sunrise.Add(-2 * time.Hour).UTC(), 20},
+		{sun.Sunset.Add(3 * time.Hour).UTC(), 20},
+	} {
+		if out, err := s.Percent(test.at); err != nil || out != test.exp {
+			t.Fatalf("%v want %v but out %v %v", test.at, test.exp, out, err)
+		}
+	}
+	s.Longitude = 0
+
+	// polar
+	for _, test := range []struct {
+		lat float64
+		exp float64
+	}{
+		{80, 20},
+		{-80, 100},
+	} {
+		s.Latitude = test.lat
+		if out, err := s.Percent(time.Date(2021, 12, 21, 12, 0, 0, 0, time.UTC)); err != nil || out != test.exp {
+			t.Fatalf("latitude %v want %v but out %v %v", test.lat, test.exp, out, err)
+		}
+	}
+	s.Latitude = 0
+
+	// the fade of Update is driven by the clock
+	{
+		m := &recordMock{mock: mock{current: 20, max: 100}}
+		d := &Device{internal: m, max: 100}
+		d.SetCurve(LinearCurve)
+		sun, err := Sun(day, 0, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		clock := &fakeClock{now: sun.Sunrise}
+		s.Clock, s.Fade, s.Easing = clock, time.Minute, Linear
+		if err := s.Update(context.Background(), d); err != nil {
+			t.Fatal(err)
+		}
+		if m.current != 60 || len(m.history) < 30 {
+			t.Fatalf("unexpected writes %v", m.history)
+		}
+		for i := 1; i < len(m.history); i++ {
+			if m.history[i] < m.history[i-1] {
+				t.Fatalf("not monotonic %v", m.history)
+			}
+		}
+		if exp := sun.Sunrise.Add(time.Minute); !clock.Now().Equal(exp) {
+			t.Fatalf("want %v but out %v", exp, clock.Now())
+		}
+	}
+
+	// the literal Schedule without Clock uses SystemClock
+	{
+		d := &Device{internal: &mock{current: 20, max: 100}, max: 100}
+		literal := &Schedule{Day: 100, Night: 100, Morning: s.Morning, Evening: s.Evening}
+		if err := literal.Update(context.Background(), d); err != nil {
+			t.Fatal(err)
+		}
+		if out, _ := d.Current(); out != 100 {
+			t.Fatalf("want 100 but out %d", out)
+		}
+	}
+
+	// run from the midnight to the noon
+	m := &recordMock{mock: mock{current: 50, max: 100}}
+	d := &Device{internal: m, max: 100}
+	d.SetCurve(LinearCurve)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	s.Clock = &stopClock{fakeClock: &fakeClock{now: day}, stop: day.Add(12 * time.Hour), cancel: cancel}
+	s.Fade, s.Interval = 0, 10*time.Minute
+	if err := s.Run(ctx, d); err != context.Canceled {
+		t.Fatalf("expected context.Canceled but %v", err)
+	}
+	if m.current != 100 || m.history[0] != 20 {
+		t.Fatalf("unexpected writes %v", m.history)
+	}
+	for i := 1; i < len(m.history); i++ {
+		if m.history[i] < m.history[i-1] {
+			t.Fatalf("not monotonic %v", m.history)
+		}
+	}
+	// 10 minutes steps in the 2 hours window
+	if len(m.history) < 10 || len(m.history) > 14 {
+		t.Fatalf("unexpected writes %v", m.history)
+	}
+}
+
+// jump the time once at the time like the suspend
+type suspendClock struct {
+	*fakeClock
+	at    time.Time
+	sleep time.Duration
+	done  bool
+}
+
+func (c *suspendClock) After(d time.Duration) <-chan time.Time {
+	if !c.done && !c.Now().Before(c.at) {
+		c.done = true
+		d += c.sleep
+	}
+	return c.fakeClock.After(d)
+}
+
+// count the sleeps
+type countClock struct {
+	*fakeClock
+	n int
+}
+
+func (c *countClock) After(d time.Duration) <-chan time.Time {
+	c.n++
+	return c.fakeClock.After(d)
+}
+
+// cancel at the time
+type stopClock struct {
+	*fakeClock
+	stop   time.Time
+	cancel func()
+}
+
+func (c *stopClock) After(d time.Duration) <-chan time.Time {
+	ch := c.fakeClock.After(d)
+	if !c.Now().Before(c.stop) {
+		c.cancel()
+		return nil
+	}
+	return ch
+}
+
+func TestParseAlarmTime(t *testing.T) {
+	now := time.Date(2021, 3, 20, 6, 0, 0, 0, time.UTC)
+	for _, test := range []struct {
+		in  string
+		exp time.Time
+	}{
+		{"07:00", time.Date(2021, 3, 20, 7, 0, 0, 0, time.UTC)},
+		{"6:30", time.Date(2021, 3, 20, 6, 30, 0, 0, time.UTC)},
+		{"06:00", time.Date(2021, 3, 21, 6, 0, 0, 0, time.UTC)},
+		{"05:00", time.Date(2021, 3, 21, 5, 0, 0, 0, time.UTC)},
+		{"0:00", time.Date(2021, 3, 21, 0, 0, 0, 0, time.UTC)},
+	} {
+		out, err := ParseAlarmTime(now, test.in)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !out.Equal(test.exp) {
+			t.Fatalf("%s want %v but out %v", test.in, test.exp, out)
+		}
+	}
+	for _, in := range []string{"", "7", "24:00", "07:60", "a:00", "07:00:00", "-1:00"} {
+		if _, err := ParseAlarmTime(now, in); err == nil {
+			t.Fatalf("%q expected error but nil", in)
+		}
+	}
+}
+
+func TestAlarm(t *testing.T) {
+	tmp := FadeInterval
+	defer func() { FadeInterval = tmp }()
+	FadeInterval = time.Millisecond
+
+	// wait for the start of the ramp by the chunks
+	start := time.Date(2021, 3, 20, 0, 0, 0, 0, time.UTC)
+	clock := &fakeClock{now: start}
+	a := &Alarm{At: start.Add(7 * time.Hour), Ramp: 20 * time.Minute, Target: 100, Clock: clock}
+	if err := a.Wait(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if exp := start.Add(6*time.Hour + 40*time.Minute); !clock.Now().Equal(exp) {
+		t.Fatalf("want %v but out %v", exp, clock.Now())
+	}
+
+	// canceled while waiting
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	a.Clock = &stopClock{fakeClock: &fakeClock{now: start}, stop: start.Add(3 * time.Hour), cancel: cancel}
+	m := &recordMock{mock: mock{current: 50, max: 100}}
+	d := &Device{internal: m, max: 100}
+	if err := a.Run(ctx, d); err != context.Canceled {
+		t.Fatalf("expected context.Canceled but %v", err)
+	}
+	if len(m.history) != 0 {
+		t.Fatalf("unexpected writes %v", m.history)
+	}
+
+	for _, test := range []struct {
+		curve   Curve
+		current uint
+		at      time.Duration
+		ramp    time.Duration
+		target  uint
+		first   uint
+		final   uint
+	}{
+		// from the min
+		{LinearCurve, 5, 50 * time.Millisecond, 50 * time.Millisecond, 100, 10, 100},
+		{CIELCurve, 5, 50 * time.Millisecond, 50 * time.Millisecond, 80, 10, 80},
+		// started late, resume from the half
+		{LinearCurve, 5, 50 * time.Millisecond, 100 * time.Millisecond, 100, 55, 100},
+		// already brighter is not lowered
+		{LinearCurve, 80, 50 * time.Millisecond, 50 * time.Millisecond, 100, 81, 100},
+		{LinearCurve, 90, 50 * time.Millisecond, 50 * time.Millisecond, 50, 0, 90},
+		// over the time
+		{LinearCurve, 5, -time.Minute, 20 * time.Minute, 100, 100, 100},
+	} {
+		m := &recordMock{mock: mock{current: test.current, max: 100}}
+		d := &Device{internal: m, max: 100}
+		d.SetCurve(test.curve)
+		start := time.Date(2021, 3, 20, 6, 40, 0, 0, time.UTC)
+		clock := &fakeClock{now: start}
+		a := &Alarm{At: start.Add(test.at), Ramp: test.ramp, Target: test.target, Clock: clock}
+		if err := a.Raise(context.Background(), d); err != nil {
+			t.Fatal(err)
+		}
+		if m.current != test.final {
+			t.Fatalf("%+v unexpected writes %v", test, m.history)
+		}
+		if test.first == 0 {
+			if len(m.history) != 0 {
+				t.Fatalf("%+v unexpected writes %v", test, m.history)
+			}
+			continue
+		}
+		if m.history[0] != test.first {
+			t.Fatalf("%+v unexpected writes %v", test, m.history)
+		}
+		for i := 1; i < len(m.history); i++ {
+			if m.history[i] <= m.history[i-1] {
+				t.Fatalf("%+v not increasing %v", test, m.history)
+			}
+		}
+		if test.at > 0 && (len(m.history) < 10 || !clock.Now().Equal(a.At)) {
+			t.Fatalf("%+v ended at %v by %v", test, clock.Now(), m.history)
+		}
+	}
+
+	// suspended while raising, the ramp ends at the time
+	{
+		FadeInterval = time.Second
+		m := &recordMock{mock: mock{current: 5, max: 100}}
+		d := &Device{internal: m, max: 100}
+		d.SetCurve(LinearCurve)
+		start := time.Date(2021, 3, 20, 6, 40, 0, 0, time.UTC)
+		clock := &suspendClock{fakeClock: &fakeClock{now: start}, at: start.Add(5 * time.Minute), sleep: 10 * time.Minute}
+		a := &Alarm{At: start.Add(20 * time.Minute), Ramp: 20 * time.Minute, Target: 100, Clock: clock}
+		if err := a.Raise(context.Background(), d); err != nil {
+			t.Fatal(err)
+		}
+		if m.current != 100 || !clock.Now().Equal(a.At) {
+			t.Fatalf("ended at %v by %d", clock.Now(), m.current)
+		}
+		FadeInterval = time.Millisecond
+	}
+
+	// sleeps until the next raw brightness, not at every FadeInterval
+	{
+		m := &recordMock{mock: mock{current: 5, max: 100}}
+		d := &Device{internal: m, max: 100}
+		d.SetCurve(LinearCurve)
+		start := time.Date(2021, 3, 20, 6, 40, 0, 0, time.UTC)
+		clock := &countClock{fakeClock: &fakeClock{now: start}}
+		a := &Alarm{At: start.Add(20 * time.Minute), Ramp: 20 * time.Minute, Target: 100, Clock: clock}
+		if err := a.Raise(context.Background(), d); err != nil {
+			t.Fatal(err)
+		}
+		if m.current != 100 || len(m.history) != 91 || !clock.Now().Equal(a.At) {
+			t.Fatalf("ended at %v by %v", clock.Now(), m.history)
+		}
+		if clock.n > 2*len(m.history) {
+			t.Fatalf("too many wakeups %d for %d writes", clock.n, len(m.history))
+		}
+	}
+
+	// over the limits
+	a = &Alarm{At: time.Now(), Target: 101}
+	if err := a.Run(context.Background(), d); err == nil {
+		t.Fatal("expected error but nil")
+	}
+}
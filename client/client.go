@@ -0,0 +1,299 @@
+// package client provides the client of the akari daemon.
+//
+// The remote devices work like brightness.Device over the daemon socket.
+package client
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/yaeshimo/brightness"
+	"github.com/yaeshimo/brightness/daemon"
+)
+
+// ErrClosed is returned after the connection is closed.
+var ErrClosed = errors.New("client: connection closed")
+
+// Client is a connection to the daemon, safe for concurrent use.
+type Client struct {
+	conn net.Conn
+
+	// serialize the writes
+	wmu sync.Mutex
+
+	mu      sync.Mutex
+	id      int
+	pending map[int]chan *daemon.Response
+	subs    map[chan Event]bool
+	err     error // set when the connection is lost
+}
+
+// Event is the change of the device notified by the daemon.
+type Event struct {
+	Event string
+	State brightness.DeviceState
+
+	// "software" or "hardware", see brightness.Source
+	Source string
+}
+
+// Dial connects to the daemon on the socket, daemon.DefaultSocket() if empty.
+func Dial(socket string) (*Client, error) {
+	if socket == "" {
+		socket = daemon.DefaultSocket()
+	}
+	conn, err := net.Dial("unix", socket)
+	if err != nil {
+		return nil, err
+	}
+	c := &Client{
+		conn:    conn,
+		pending: make(map[int]chan *daemon.Response),
+		subs:    make(map[chan Event]bool),
+	}
+	go c.read()
+	return c, nil
+}
+
+// Close closes the connection, the channels of Subscribe are closed.
+func (c *Client) Close() error { return c.conn.Close() }
+
+// dispatch the lines to the pending requests and the subscribers
+func (c *Client) read() {
+	scanner := bufio.NewScanner(c.conn)
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		var kind struct {
+			Event string `json:"event"`
+		}
+		if json.Unmarshal(line, &kind) == nil && kind.Event != "" {
+			var ev daemon.Event
+			if err := json.Unmarshal(line, &ev); err == nil {
+				c.broadcast(Event{Event: ev.Event, State: ev.State, Source: ev.Source})
+			}
+			continue
+		}
+		resp := new(daemon.Response)
+		if err := json.Unmarshal(line, resp); err != nil {
+			continue
+		}
+		c.mu.Lock()
+		ch, ok := c.pending[resp.ID]
+		delete(c.pending, resp.ID)
+		c.mu.Unlock()
+		if ok {
+			ch <- resp
+		}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.err = ErrClosed
+	for id, ch := range c.pending {
+		close(ch)
+		delete(c.pending, id)
+	}
+	for ch := range c.subs {
+		close(ch)
+		delete(c.subs, ch)
+	}
+}
+
+// the event is dropped for the subscriber that does not receive in time
+func (c *Client) broadcast(ev Event) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for ch := range c.subs {
+		select {
+		case ch <- ev:
+		default:
+		}
+	}
+}
+
+// Do sends the request and waits the response, the ID of the request is overwritten.
+// The error of the response is returned as error.
+func (c *Client) Do(req daemon.Request) (*daemon.Response, error) {
+	c.mu.Lock()
+	if c.err != nil {
+		c.mu.Unlock()
+		return nil, c.err
+	}
+	c.id++
+	req.ID = c.id
+	ch := make(chan *daemon.Response, 1)
+	c.pending[req.ID] = ch
+	c.mu.Unlock()
+
+	b, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+	c.wmu.Lock()
+	_, err = c.conn.Write(append(b, '\n'))
+	c.wmu.Unlock()
+	if err != nil {
+		c.mu.Lock()
+		delete(c.pending, req.ID)
+		c.mu.Unlock()
+		return nil, err
+	}
+	resp, ok := <-ch
+	if !ok {
+		return nil, ErrClosed
+	}
+	if resp.Error != "" {
+		return nil, errors.New(resp.Error)
+	}
+	return resp, nil
+}
+
+// Subscribe returns the channel of the change events until ctx is done or the connection is closed.
+// The events are dropped if the channel is not received in time.
+func (c *Client) Subscribe(ctx context.Context) (<-chan Event, error) {
+	if _, err := c.Do(daemon.Request{Method: daemon.MethodSubscribe}); err != nil {
+		return nil, err
+	}
+	ch := make(chan Event, 16)
+	c.mu.Lock()
+	if c.err != nil {
+		c.mu.Unlock()
+		return nil, c.err
+	}
+	c.subs[ch] = true
+	c.mu.Unlock()
+	go func() {
+		<-ctx.Done()
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		if c.subs[ch] {
+			delete(c.subs, ch)
+			close(ch)
+		}
+	}()
+	return ch, nil
+}
+
+// Devices returns the devices of the daemon.
+func (c *Client) Devices() ([]*Device, error) {
+	resp, err := c.Do(daemon.Request{Method: daemon.MethodList})
+	if err != nil {
+		return nil, err
+	}
+	devices := make([]*Device, 0, len(resp.Devices))
+	for _, state := range resp.Devices {
+		devices = append(devices, &Device{c: c, name: state.Name, max: state.Max})
+	}
+	return devices, nil
+}
+
+// Device returns the device by the name.
+func (c *Client) Device(name string) (*Device, error) {
+	d := &Device{c: c, name: name}
+	resp, err := d.do(daemon.Request{Method: daemon.MethodGet})
+	if err != nil {
+		return nil, err
+	}
+	d.name, d.max = resp.State.Name, resp.State.Max
+	return d, nil
+}
+
+// Device is the remote device, the methods are same as brightness.Device.
+type Device struct {
+	c    *Client
+	name string
+	max  uint
+}
+
+func (d *Device) Name() string { return d.name }
+func (d *Device) Max() uint    { return d.max }
+
+func (d *Device) Current() (uint, error) {
+	resp, err := d.do(daemon.Request{Method: daemon.MethodGet})
+	if err != nil {
+		return 0, err
+	}
+	return resp.State.Current, nil
+}
+
+// Percent returns the perceived brightness in [0, 100] by the curve of the daemon.
+func (d *Device) Percent() (float64, error) {
+	resp, err := d.do(daemon.Request{Method: daemon.MethodGet})
+	if err != nil {
+		return 0, err
+	}
+	return resp.Percent, nil
+}
+
+// if force is true then ignore the limit
+func (d *Device) Set(want uint, force bool) error {
+	_, err := d.do(daemon.Request{
+		Method: daemon.MethodSet,
+		Value:  strconv.FormatUint(uint64(want), 10),
+		Force:  force,
+	})
+	return err
+}
+
+func (d *Device) SetMax() error { return d.setValue("max") }
+func (d *Device) SetMid() error { return d.setValue("mid") }
+func (d *Device) SetMin() error { return d.setValue("min") }
+
+func (d *Device) setValue(value string) error {
+	_, err := d.do(daemon.Request{Method: daemon.MethodSet, Value: value})
+	return err
+}
+
+func (d *Device) Step(delta brightness.Delta) error {
+	_, err := d.do(daemon.Request{Method: daemon.MethodStep, Delta: delta.String()})
+	return err
+}
+
+// FadeTo fades on the daemon, the easing is the name in daemon.Easings.
+// The fade is stopped by the following writes to the device.
+func (d *Device) FadeTo(target uint, duration time.Duration, easing string) error {
+	_, err := d.do(daemon.Request{
+		Method:   daemon.MethodFade,
+		Value:    strconv.FormatUint(uint64(target), 10),
+		Duration: duration.String(),
+		Easing:   easing,
+	})
+	return err
+}
+
+// Alarm ramps the brightness up to the value on the daemon, the ramp ends at the time at.
+// The value is "NUMBER", "NUMBER%", "max", "mid" or "min".
+// It returns after the ramp, or the error if stopped by Cancel or the following writes while ramping.
+func (d *Device) Alarm(at time.Time, ramp time.Duration, value string) error {
+	_, err := d.do(daemon.Request{
+		Method:   daemon.MethodAlarm,
+		At:       at.Format(time.RFC3339),
+		Duration: ramp.String(),
+		Value:    value,
+	})
+	return err
+}
+
+// Cancel stops the alarm and the fade of the device on the daemon.
+func (d *Device) Cancel() error {
+	_, err := d.do(daemon.Request{Method: daemon.MethodCancel})
+	return err
+}
+
+func (d *Device) do(req daemon.Request) (*daemon.Response, error) {
+	req.Device = d.name
+	resp, err := d.c.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.State == nil {
+		return nil, errors.New("client: unexpected response without state")
+	}
+	return resp, nil
+}
@@ -0,0 +1,247 @@
+package client
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/yaeshimo/brightness"
+	"github.com/yaeshimo/brightness/daemon"
+)
+
+// for brightness.Controller
+type mock struct {
+	mu           sync.Mutex
+	name         string
+	current, max uint
+}
+
+func (m *mock) Name() string { return m.name }
+func (m *mock) Current() (uint, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.current, nil
+}
+func (m *mock) Max() (uint, error) { return m.max, nil }
+func (m *mock) Set(ui uint) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.current = ui
+	return nil
+}
+
+type mockBackend []*mock
+
+func (b mockBackend) Discover() ([]brightness.Controller, error) {
+	cs := make([]brightness.Controller, 0, len(b))
+	for _, m := range b {
+		cs = append(cs, m)
+	}
+	return cs, nil
+}
+
+func TestMain(m *testing.M) {
+	// only the mock devices
+	for _, name := range brightness.Backends() {
+		brightness.Unregister(name)
+	}
+	brightness.Register("mock", mockBackend{
+		{name: "mock0", current: 50, max: 100},
+		{name: "mock1", current: 5, max: 7},
+	})
+	brightness.DefaultOrder = brightness.OrderName
+	os.Exit(m.Run())
+}
+
+// in-process daemon on the temporary socket
+func startDaemon(t *testing.T) (socket string, stop func()) {
+	dir, err := ioutil.TempDir("", "TestClient")
+	if err != nil {
+		t.Fatal(err)
+	}
+	socket = filepath.Join(dir, "akari.sock")
+	s, err := daemon.NewServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ln, err := daemon.Listen(socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan error, 1)
+	go func() { done <- s.Serve(ln) }()
+	var once sync.Once
+	return socket, func() {
+		once.Do(func() {
+			s.Close()
+			if err := <-done; err != nil {
+				t.Error(err)
+			}
+			os.RemoveAll(dir)
+		})
+	}
+}
+
+func TestClient(t *testing.T) {
+	socket, stop := startDaemon(t)
+	defer stop()
+
+	c, err := Dial(socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	devices, err := c.Devices()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(devices) != 2 || devices[0].Name() != "mock0" || devices[0].Max() != 100 {
+		t.Fatalf("unexpected devices %+v", devices)
+	}
+	d := devices[0]
+
+	for _, test := range []struct {
+		f   func() error
+		exp uint
+	}{
+		{func() error { return d.Set(80, false) }, 80},
+		{d.SetMin, 10},
+		{d.SetMid, 50},
+		{d.SetMax, 100},
+		{func() error { return d.Step(brightness.PercentDelta(-5)) }, 95},
+		{func() error { return d.Step(brightness.RawDelta(-5)) }, 90},
+		{func() error { return d.FadeTo(60, 10*time.Millisecond, "ease-in-out") }, 60},
+		{func() error { return d.Alarm(time.Now(), time.Minute, "max") }, 100},
+		{d.Cancel, 100},
+		{func() error { return d.Set(0, true) }, 0},
+	} {
+		if err := test.f(); err != nil {
+			t.Fatal(err)
+		}
+		out, err := d.Current()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if out != test.exp {
+			t.Fatalf("exp %d but out %d", test.exp, out)
+		}
+	}
+	if err := d.Set(0, false); err == nil {
+		t.Fatal("expected error but nil")
+	}
+	if err := d.Set(50, false); err != nil {
+		t.Fatal(err)
+	}
+	if p, err := d.Percent(); err != nil || p != 50 {
+		t.Fatalf("unexpected percent %v %v", p, err)
+	}
+
+	d, err = c.Device("mock1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.Max() != 7 {
+		t.Fatalf("unexpected max %d", d.Max())
+	}
+	if _, err := c.Device("not exist"); err == nil {
+		t.Fatal("expected error but nil")
+	}
+}
+
+func TestDeviceWithoutState(t *testing.T) {
+	dir, err := ioutil.TempDir("", "TestClient")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	socket := filepath.Join(dir, "akari.sock")
+	ln, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	// the broken daemon responds without the state
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		scanner := bufio.NewScanner(conn)
+		for scanner.Scan() {
+			var req daemon.Request
+			json.Unmarshal(scanner.Bytes(), &req)
+			json.NewEncoder(conn).Encode(&daemon.Response{ID: req.ID})
+		}
+	}()
+
+	c, err := Dial(socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	if _, err := c.Device("mock0"); err == nil {
+		t.Fatal("expected error but nil")
+	}
+}
+
+func TestSubscribe(t *testing.T) {
+	socket, stop := startDaemon(t)
+	defer stop()
+
+	sub, err := Dial(socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sub.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	events, err := sub.Subscribe(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := Dial(socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	d, err := c.Device("mock1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Set(3, false); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case ev := <-events:
+		if ev.Event != daemon.EventChange || ev.State.Name != "mock1" || ev.State.Current != 3 {
+			t.Fatalf("unexpected event %+v", ev)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout")
+	}
+
+	cancel()
+	for range events {
+	}
+
+	// closed by the daemon
+	events, err = sub.Subscribe(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	stop()
+	for range events {
+	}
+	if _, err := sub.Devices(); err != ErrClosed {
+		t.Fatalf("expected ErrClosed but %v", err)
+	}
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/yaeshimo/brightness"
+	"github.com/yaeshimo/brightness/client"
+	"github.com/yaeshimo/brightness/daemon"
+)
+
+// akari alarm
+func runAlarm(args []string) error {
+	fs := flag.NewFlagSet(Name+" alarm", flag.ContinueOnError)
+	fs.SetOutput(os.Stderr)
+	ramp := fs.Duration("ramp", 20*time.Minute, "Duration of raising brightness until the alarm time")
+	to := fs.String("to", "100%", "Brightness at the alarm time [NUMBER%|NUMBER|max|mid|min]")
+	index := fs.Int("index", 0, "Specify device index")
+	cancel := fs.Bool("cancel", false, "Cancel the alarm running on the daemon")
+	socket := fs.String("socket", daemon.DefaultSocket(), "Path to the socket of the running daemon")
+	direct := fs.Bool("direct", false, "Access devices directly even if the daemon is running")
+	sysfs := fs.String("sysfs", "/sys", "Root of sysfs")
+	logind := logindFlag(fs)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage:\n")
+		fmt.Fprintf(fs.Output(), "  %s alarm HH:MM [Options]\n", Name)
+		fmt.Fprintf(fs.Output(), "  %s alarm -cancel [Options]\n", Name)
+		fmt.Fprintf(fs.Output(), "\n")
+		fmt.Fprintf(fs.Output(), "Options:\n")
+		fs.PrintDefaults()
+	}
+	// accept the time before the options
+	var at string
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		at, args = args[0], args[1:]
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if at == "" && fs.NArg() > 0 {
+		at = fs.Arg(0)
+		if err := fs.Parse(fs.Args()[1:]); err != nil {
+			return err
+		}
+	}
+	if fs.NArg() != 0 {
+		fs.Usage()
+		return fmt.Errorf("invalid arguments: %v", fs.Args())
+	}
+	if *cancel {
+		if at != "" {
+			fs.Usage()
+			return errors.New("-cancel does not take the time")
+		}
+		return cancelAlarm(*socket, *index)
+	}
+	if at == "" {
+		fs.Usage()
+		return errors.New("alarm requires the time")
+	}
+	if *ramp < 0 {
+		return errors.New("ramp must not be negative")
+	}
+	if err := useSysfs(*sysfs, *logind); err != nil {
+		return err
+	}
+
+	a := &brightness.Alarm{Ramp: *ramp}
+	var err error
+	if a.At, err = brightness.ParseAlarmTime(time.Now(), at); err != nil {
+		return err
+	}
+	fmt.Printf("ramp %s - %s\n", a.At.Add(-a.Ramp).Format("15:04"), a.At.Format("15:04"))
+
+	ctx, stop := signalContext()
+	defer stop()
+
+	// run on the daemon if running, so the writes are serialized with the others
+	if !*direct {
+		if c, err := client.Dial(*socket); err == nil {
+			defer c.Close()
+			return alarmClient(ctx, c, *index, a, *to)
+		}
+	}
+
+	device, err := brightness.ReadDeviceIndex(*index)
+	if err != nil {
+		return err
+	}
+	// same as the daemon
+	if a.Target, err = daemon.ParseValue(device, *to); err != nil {
+		return err
+	}
+	if err := a.Run(ctx, device); err != context.Canceled {
+		return err
+	}
+	return nil
+}
+
+// run the alarm on the daemon, closing the connection cancels it
+func alarmClient(ctx context.Context, c *client.Client, index int, a *brightness.Alarm, to string) error {
+	devices, err := c.Devices()
+	if err != nil {
+		return err
+	}
+	if index < 0 || index >= len(devices) {
+		return errors.New("invalid index " + strconv.Itoa(index))
+	}
+	done := make(chan error, 1)
+	go func() { done <- devices[index].Alarm(a.At, a.Ramp, to) }()
+	select {
+	case err := <-done:
+		// stopped by akari alarm -cancel or the following writes
+		if err != nil && err.Error() == context.Canceled.Error() {
+			return nil
+		}
+		return err
+	case <-ctx.Done():
+		return nil
+	}
+}
+
+func cancelAlarm(socket string, index int) error {
+	c, err := client.Dial(socket)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+	devices, err := c.Devices()
+	if err != nil {
+		return err
+	}
+	if index < 0 || index >= len(devices) {
+		return errors.New("invalid index " + strconv.Itoa(index))
+	}
+	return devices[index].Cancel()
+}
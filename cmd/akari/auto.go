@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/yaeshimo/brightness"
+)
+
+// akari auto
+func runAuto(args []string) error {
+	fs := flag.NewFlagSet(Name+" auto", flag.ContinueOnError)
+	fs.SetOutput(os.Stderr)
+	def := brightness.NewAutoController(nil, nil)
+	index := fs.Int("index", 0, "Specify device index")
+	sensor := fs.String("sensor", "", "Specify sensor by the ID e.g. iio:device0, the first if empty")
+	configure := autoFlags(fs)
+	fade := fs.Duration("fade", def.Fade, "Fade duration of each change, up to -interval")
+	easing := fs.String("easing", "ease-in-out", "Easing of -fade [linear|ease-in-out|exponential]")
+	learn := fs.Bool("learn", true, "Learn the curve from the brightness changed by others e.g. -inc and -dec")
+	dir := fs.String("state-dir", userStateDir(), "Directory to store the learned curve")
+	iio := fs.String("iio", "/sys/bus/iio/devices", "Root of IIO devices")
+	sysfs := fs.String("sysfs", "/sys", "Root of sysfs")
+	logind := logindFlag(fs)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage:\n")
+		fmt.Fprintf(fs.Output(), "  %s auto [Options]\n", Name)
+		fmt.Fprintf(fs.Output(), "\n")
+		fmt.Fprintf(fs.Output(), "Options:\n")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 0 {
+		fs.Usage()
+		return fmt.Errorf("invalid arguments: %v", fs.Args())
+	}
+	if err := useSysfs(*sysfs, *logind); err != nil {
+		return err
+	}
+
+	src, err := findSensor(*iio, *sensor)
+	if err != nil {
+		return err
+	}
+	device, err := brightness.ReadDeviceIndex(*index)
+	if err != nil {
+		return err
+	}
+	a := brightness.NewAutoController(device, src)
+	if err := configure(a); err != nil {
+		return err
+	}
+	var ok bool
+	if a.Easing, ok = easings[*easing]; !ok {
+		return errors.New("invalid easing " + *easing)
+	}
+	a.Fade = *fade
+	if *learn {
+		p := &brightness.Persister{Dir: *dir}
+		model, err := p.LoadLuxModel(device)
+		switch {
+		case os.IsNotExist(err):
+			model = new(brightness.LuxModel)
+		case err != nil:
+			return err
+		}
+		model.Base = a.Curve
+		if a.Curve, err = model.Fit(); err != nil {
+			return err
+		}
+		a.Model = model
+		a.OnLearn = func(m *brightness.LuxModel) error { return p.SaveLuxModel(device, m) }
+	}
+
+	ctx, cancel := signalContext()
+	defer cancel()
+	if err := a.Run(ctx); err != context.Canceled {
+		return err
+	}
+	return nil
+}
+
+// flags shared by auto and simulate, returns the function to apply them
+func autoFlags(fs *flag.FlagSet) func(a *brightness.AutoController) error {
+	def := brightness.NewAutoController(nil, nil)
+	curve := fs.String("curve", def.Curve.String(), "Curve from lux to brightness [LUX:PERCENT,...]")
+	smoothing := fs.Duration("smoothing", def.Smoothing, "Time constant of smoothing lux")
+	hysteresis := fs.Float64("hysteresis", def.Hysteresis, "Minimum change of brightness in percent to follow lux")
+	rate := fs.Float64("rate", def.MaxRate, "Maximum change of brightness in percent per second, unlimited if 0")
+	interval := fs.Duration("interval", def.Interval, "Interval of reading lux")
+	return func(a *brightness.AutoController) error {
+		var err error
+		if a.Curve, err = brightness.ParseLuxCurve(*curve); err != nil {
+			return err
+		}
+		a.Smoothing = *smoothing
+		a.Hysteresis = *hysteresis
+		a.MaxRate = *rate
+		a.Interval = *interval
+		return nil
+	}
+}
+
+// "$XDG_STATE_HOME/akari" or "~/.local/state/akari"
+func userStateDir() string {
+	if dir := os.Getenv("XDG_STATE_HOME"); dir != "" {
+		return filepath.Join(dir, Name)
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return filepath.Join(os.TempDir(), Name)
+	}
+	return filepath.Join(home, ".local", "state", Name)
+}
@@ -0,0 +1,26 @@
+// +build linux
+
+package main
+
+import (
+	"errors"
+
+	"github.com/yaeshimo/brightness/als"
+)
+
+// the sensor by the ID, or the first
+func findSensor(root, id string) (als.Source, error) {
+	sensors, err := als.DiscoverRoot(root)
+	if err != nil {
+		return nil, err
+	}
+	if id == "" {
+		return sensors[0], nil
+	}
+	for _, s := range sensors {
+		if s.ID() == id {
+			return s, nil
+		}
+	}
+	return nil, errors.New("not found sensor " + id)
+}
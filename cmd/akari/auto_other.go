@@ -0,0 +1,14 @@
+// +build !linux
+
+package main
+
+import (
+	"errors"
+
+	"github.com/yaeshimo/brightness/als"
+)
+
+// the ambient light sensors are only on linux
+func findSensor(root, id string) (als.Source, error) {
+	return nil, errors.New("ambient light sensor is not supported on this platform")
+}
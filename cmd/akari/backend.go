@@ -0,0 +1,12 @@
+package main
+
+import (
+	"flag"
+)
+
+const logindUsage = "Write through systemd-logind [never|fallback|always]"
+
+// -logind of the subcommands writing the brightness
+func logindFlag(fs *flag.FlagSet) *string {
+	return fs.String("logind", "fallback", logindUsage)
+}
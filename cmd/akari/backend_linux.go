@@ -0,0 +1,30 @@
+// +build linux
+
+package main
+
+import (
+	"errors"
+
+	"github.com/yaeshimo/brightness"
+)
+
+// replace the default sysfs backend by the sysfs under root,
+// that writes through logind by the mode of -logind
+func useSysfs(root, logind string) error {
+	var opts []brightness.SysfsOption
+	switch logind {
+	case "never":
+		if root == "/sys" {
+			return nil
+		}
+	case "fallback", "always":
+		opts = append(opts, brightness.WithLogind(&brightness.Logind{
+			Always: logind == "always",
+		}))
+	default:
+		return errors.New("invalid logind mode " + logind)
+	}
+	brightness.Unregister("sysfs")
+	brightness.Register("sysfs", brightness.NewSysfs(root, opts...))
+	return nil
+}
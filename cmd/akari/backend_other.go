@@ -0,0 +1,20 @@
+// +build !linux
+
+package main
+
+import (
+	"errors"
+)
+
+// sysfs and logind are only on linux, accept the defaults of the flags
+func useSysfs(root, logind string) error {
+	switch logind {
+	case "never", "fallback", "always":
+	default:
+		return errors.New("invalid logind mode " + logind)
+	}
+	if root != "/sys" {
+		return errors.New("sysfs is not supported on this platform")
+	}
+	return nil
+}
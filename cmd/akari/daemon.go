@@ -0,0 +1,111 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/yaeshimo/brightness/client"
+	"github.com/yaeshimo/brightness/daemon"
+)
+
+// akari daemon
+func runDaemon(args []string) error {
+	fs := flag.NewFlagSet(Name+" daemon", flag.ContinueOnError)
+	fs.SetOutput(os.Stderr)
+	socket := fs.String("socket", daemon.DefaultSocket(), "Path to the Unix socket")
+	sysfs := fs.String("sysfs", "/sys", "Root of sysfs")
+	logind := logindFlag(fs)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage:\n")
+		fmt.Fprintf(fs.Output(), "  %s daemon [Options]\n", Name)
+		fmt.Fprintf(fs.Output(), "\n")
+		fmt.Fprintf(fs.Output(), "Options:\n")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 0 {
+		fs.Usage()
+		return fmt.Errorf("invalid arguments: %v", fs.Args())
+	}
+	if err := useSysfs(*sysfs, *logind); err != nil {
+		return err
+	}
+
+	s, err := daemon.NewServer()
+	if err != nil {
+		return err
+	}
+	ln, err := daemon.Listen(*socket)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(*socket)
+
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(sig)
+	go func() {
+		<-sig
+		s.Close()
+	}()
+	return s.Serve(ln)
+}
+
+// request for the running daemon, return false if the options are not supported by the daemon
+func daemonRequest() (daemon.Request, bool) {
+	req := daemon.Request{ID: 1, Index: opt.index, Force: opt.force}
+	for _, name := range []string{"order", "curve", "verify", "retry", "off", "on", "toggle-power"} {
+		if isFlagSet(name) {
+			return req, false
+		}
+	}
+	switch {
+	case opt.get || opt.getmax:
+		req.Method = daemon.MethodGet
+	case opt.set != "":
+		req.Method = daemon.MethodSet
+		req.Value = opt.set
+	case opt.inc.set || opt.dec.set:
+		req.Method = daemon.MethodStep
+		delta := opt.inc.delta
+		if opt.dec.set {
+			delta = opt.dec.delta
+			delta.Value = -delta.Value
+		}
+		req.Delta = delta.String()
+	default:
+		return req, false
+	}
+	if opt.fade > 0 && req.Method != daemon.MethodGet {
+		req.Method = daemon.MethodFade
+		req.Duration = opt.fade.String()
+		req.Easing = opt.easing
+	}
+	return req, true
+}
+
+// send the request to the daemon and print the result like the direct access
+func runClient(c *client.Client, req daemon.Request) error {
+	resp, err := c.Do(req)
+	if err != nil {
+		return err
+	}
+	if resp.State == nil {
+		return errors.New("unexpected response without state")
+	}
+	switch {
+	case opt.get && opt.percent:
+		_, err = fmt.Printf("%.2f\n", resp.Percent)
+	case opt.get:
+		_, err = fmt.Println(resp.State.Current)
+	case opt.getmax:
+		_, err = fmt.Println(resp.State.Max)
+	}
+	return err
+}
@@ -5,14 +5,23 @@
 package main
 
 import (
+	"context"
 	"errors"
 	"flag"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"os"
+	"os/signal"
+	"path/filepath"
 	"strconv"
+	"strings"
+	"syscall"
+	"time"
 
 	"github.com/yaeshimo/brightness"
+	"github.com/yaeshimo/brightness/client"
+	"github.com/yaeshimo/brightness/daemon"
 )
 
 const (
@@ -48,6 +57,26 @@ var eg = &examples{
 		c: `Increment brightness 10%`,
 		e: Name + " -inc",
 	},
+	{
+		c: `Decrement brightness 2%`,
+		e: Name + " -dec 2%",
+	},
+	{
+		c: "Increment raw brightness 3",
+		e: Name + " -inc raw:3",
+	},
+	{
+		c: "Print changes of brightness by others e.g. hotkeys",
+		e: Name + " -watch",
+	},
+	{
+		c: "Save and restore brightness of all devices",
+		e: Name + " -save state.json && " + Name + " -restore state.json",
+	},
+	{
+		c: "Raise brightness to 100% over 20 minutes until 07:00",
+		e: Name + " alarm 07:00 -ramp 20m -to 100%",
+	},
 	{
 		c: "Same results with -list",
 		e: Name,
@@ -59,7 +88,14 @@ func makeUsage(w *io.Writer) func() {
 		flag.CommandLine.SetOutput(*w)
 		fmt.Fprintf(*w, "Usage:\n")
 		fmt.Fprintf(*w, "  %s [Options]\n", Name)
-		fmt.Fprintf(*w, "  %s -set [NUMBER|max|mid|min]\n", Name)
+		fmt.Fprintf(*w, "  %s -set [NUMBER%%|NUMBER|max|mid|min]\n", Name)
+		fmt.Fprintf(*w, "  %s persist [Options] save|load\n", Name)
+		fmt.Fprintf(*w, "  %s daemon [Options]\n", Name)
+		fmt.Fprintf(*w, "  %s setup-udev [Options]\n", Name)
+		fmt.Fprintf(*w, "  %s auto [Options]\n", Name)
+		fmt.Fprintf(*w, "  %s simulate [Options] FILE\n", Name)
+		fmt.Fprintf(*w, "  %s schedule -lat NUMBER -lon NUMBER [Options]\n", Name)
+		fmt.Fprintf(*w, "  %s alarm HH:MM [Options]\n", Name)
 		fmt.Fprintf(*w, "\n")
 		fmt.Fprintf(*w, "Options:\n")
 		flag.PrintDefaults()
@@ -74,13 +110,35 @@ var opt struct {
 
 	list  bool
 	index int
+	order string
 
-	get    bool
-	getmax bool
+	get     bool
+	getmax  bool
+	percent bool
+	watch   bool
 
 	set string
-	inc bool
-	dec bool
+	inc stepFlag
+	dec stepFlag
+
+	verify bool
+	retry  int
+	force  bool
+
+	fade   time.Duration
+	easing string
+	curve  string
+
+	off         bool
+	on          bool
+	togglePower bool
+
+	save    string
+	restore string
+
+	socket string
+	direct bool
+	logind string
 }
 
 func init() {
@@ -89,13 +147,37 @@ func init() {
 
 	flag.BoolVar(&opt.list, "list", false, "List candidate devices")
 	flag.IntVar(&opt.index, "index", 0, "Specify device index")
+	flag.StringVar(&opt.order, "order", brightness.DefaultOrder.String(), "Order of device index [preferred|name]")
 
 	flag.BoolVar(&opt.get, "get", false, "Value of current brightness")
 	flag.BoolVar(&opt.getmax, "getmax", false, "Value of max brightness")
+	flag.BoolVar(&opt.percent, "percent", false, "Display -get as percentage")
+	flag.BoolVar(&opt.watch, "watch", false, "Print \"NAME OLD NEW SOURCE\" on every change of brightness until interrupted")
+
+	flag.StringVar(&opt.set, "set", "", "Set brightness [NUMBER%|NUMBER|min|mid|max]")
+	flag.Var(&opt.inc, "inc", `Increment brightness [NUMBER|NUMBER%|raw:NUMBER], default 10%`)
+	flag.Var(&opt.dec, "dec", `Decrement brightness [NUMBER|NUMBER%|raw:NUMBER], default 10%`)
+
+	flag.DurationVar(&opt.fade, "fade", 0, "Fade duration for -set, -inc and -dec e.g. 300ms")
+	flag.StringVar(&opt.easing, "easing", "linear", "Easing of -fade [linear|ease-in-out|exponential]")
+
+	flag.StringVar(&opt.curve, "curve", "", "Curve of percentage [linear|cie|gamma:NUMBER], default by the device")
+
+	flag.BoolVar(&opt.off, "off", false, "Power off the panel")
+	flag.BoolVar(&opt.on, "on", false, "Power on the panel and restore the brightness")
+	flag.BoolVar(&opt.togglePower, "toggle-power", false, "Toggle power of the panel")
+
+	flag.StringVar(&opt.save, "save", "", "Save brightness of all devices to the FILE")
+	flag.StringVar(&opt.restore, "restore", "", "Restore brightness of all devices from the FILE")
+
+	flag.StringVar(&opt.socket, "socket", daemon.DefaultSocket(), "Path to the socket of the running daemon")
+	flag.BoolVar(&opt.direct, "direct", false, "Access devices directly even if the daemon is running")
+
+	flag.StringVar(&opt.logind, "logind", "fallback", logindUsage)
 
-	flag.StringVar(&opt.set, "set", "", "Set brightness [NUMBER|min|mid|max]")
-	flag.BoolVar(&opt.inc, "inc", false, `Increment brightness 10%`)
-	flag.BoolVar(&opt.dec, "dec", false, `Decrement brightness 10%`)
+	flag.BoolVar(&opt.force, "force", false, "Ignore the limits of brightness e.g. permit 0")
+	flag.BoolVar(&opt.verify, "verify", false, "Verify the hardware took the brightness")
+	flag.IntVar(&opt.retry, "retry", 2, "Number of retries for -verify")
 }
 
 func state(devices ...*brightness.Device) (string, error) {
@@ -110,11 +192,29 @@ func state(devices ...*brightness.Device) (string, error) {
 	for i, device := range devices {
 		str += fmt.Sprintf("Index: %d\n", i)
 		str += fmt.Sprintf("\tName: %q\n", device.Name())
+		str += fmt.Sprintf("\tClass: %q\n", device.Class())
+		meta, err := device.Metadata()
+		if err != nil {
+			return "", err
+		}
+		str += fmt.Sprintf("\tType: %q\n", meta.Type)
+		str += fmt.Sprintf("\tPath: %q\n", meta.Path)
+		str += fmt.Sprintf("\tDriver: %q\n", meta.Driver)
+		str += fmt.Sprintf("\tParent: %q\n", meta.Parent)
+		str += fmt.Sprintf("\tSubsystem: %q\n", meta.Subsystem)
 		current, err := device.Current()
 		if err != nil {
 			return "", err
 		}
 		str += fmt.Sprintf("\tCurrent: %d\n", current)
+		actual, err := device.Actual()
+		switch err {
+		case nil:
+			str += fmt.Sprintf("\tActual: %d\n", actual)
+		case brightness.ErrNotSupported:
+		default:
+			return "", err
+		}
 		str += fmt.Sprintf("\tMax: %d\n", device.Max())
 		str += fmt.Sprintf("\tMid: %d\n", device.Mid())
 		str += fmt.Sprintf("\tMin: %d\n", device.Min())
@@ -131,17 +231,273 @@ func printState(devices ...*brightness.Device) error {
 	return err
 }
 
+// flag for -inc and -dec, "-inc" alone is 10%
+type stepFlag struct {
+	set   bool
+	delta brightness.Delta
+}
+
+func (f *stepFlag) String() string {
+	if !f.set {
+		return ""
+	}
+	return f.delta.String()
+}
+
+func (f *stepFlag) Set(s string) error {
+	if s == "true" {
+		s = "10%"
+	}
+	delta, err := brightness.ParseDelta(s)
+	if err != nil {
+		return err
+	}
+	if delta.Value < 0 {
+		return errors.New("negative step " + s)
+	}
+	f.set = true
+	f.delta = delta
+	return nil
+}
+
+func (f *stepFlag) IsBoolFlag() bool { return true }
+
+var easings = map[string]brightness.Easing{
+	"linear":      brightness.Linear,
+	"ease-in-out": brightness.EaseInOut,
+	"exponential": brightness.Exponential,
+}
+
+// for -curve
+func parseCurve(s string) (brightness.Curve, error) {
+	switch {
+	case s == "linear":
+		return brightness.LinearCurve, nil
+	case s == "cie":
+		return brightness.CIELCurve, nil
+	case strings.HasPrefix(s, "gamma:"):
+		gamma, err := strconv.ParseFloat(strings.TrimPrefix(s, "gamma:"), 64)
+		if err != nil {
+			return nil, err
+		}
+		return brightness.GammaCurve(gamma)
+	default:
+		return nil, errors.New("invalid curve " + s)
+	}
+}
+
+// the context canceled on interrupt
+func signalContext() (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(context.Background())
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		defer signal.Stop(sig)
+		select {
+		case <-sig:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	return ctx, cancel
+}
+
+// fade with -fade and -easing, stop on interrupt
+func fadeTo(device *brightness.Device, target uint) error {
+	easing, ok := easings[opt.easing]
+	if !ok {
+		return errors.New("invalid easing " + opt.easing)
+	}
+	ctx, cancel := signalContext()
+	defer cancel()
+	return device.FadeTo(ctx, target, opt.fade, easing)
+}
+
+// fade by the delta with -fade and -easing, stop on interrupt
+func fadeStep(device *brightness.Device, delta brightness.Delta) error {
+	easing, ok := easings[opt.easing]
+	if !ok {
+		return errors.New("invalid easing " + opt.easing)
+	}
+	ctx, cancel := signalContext()
+	defer cancel()
+	return device.FadeStep(ctx, delta, opt.fade, easing)
+}
+
+// print the changes until interrupted
+func watch(device *brightness.Device) error {
+	ctx, cancel := signalContext()
+	defer cancel()
+	for c := range device.Watch(ctx) {
+		if _, err := fmt.Printf("%s %d %d %s\n", device.Name(), c.Old, c.New, c.Source); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// file to remember the brightness before power off, in the runtime directory of the user
+func powerFile(device *brightness.Device) (string, error) {
+	dir, err := daemon.RuntimeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, fmt.Sprintf("%s-%d-power-%s", Name, os.Getuid(), device.Name())), nil
+}
+
+func powerOff(device *brightness.Device) error {
+	current, err := device.Current()
+	if err != nil {
+		return err
+	}
+	file, err := powerFile(device)
+	if err != nil {
+		return err
+	}
+	err = ioutil.WriteFile(file, []byte(strconv.FormatUint(uint64(current), 10)), 0600)
+	if err != nil {
+		return err
+	}
+	if err := device.PowerOff(); err != nil {
+		// the stale file would be restored by the next -on
+		os.Remove(file)
+		return err
+	}
+	return nil
+}
+
+// restore the brightness if remembered
+func powerOn(device *brightness.Device) error {
+	if err := device.PowerOn(); err != nil {
+		return err
+	}
+	file, err := powerFile(device)
+	if err != nil {
+		return err
+	}
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	if err := os.Remove(file); err != nil {
+		return err
+	}
+	i, err := strconv.ParseUint(strings.TrimSpace(string(b)), 10, 64)
+	if err != nil {
+		return err
+	}
+	return device.Set(uint(i), true)
+}
+
+func save(file string) error {
+	snapshot, err := brightness.TakeSnapshot()
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(file, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := snapshot.WriteTo(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func restore(file string) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	snapshot, err := brightness.ReadSnapshot(f)
+	if err != nil {
+		return err
+	}
+	return snapshot.Restore()
+}
+
+// flags acting on the devices, the devices are listed without them
+var actionFlags = []string{"get", "getmax", "watch", "set", "inc", "dec", "off", "on", "toggle-power", "save", "restore"}
+
+func isAnyFlagSet(names ...string) bool {
+	for _, name := range names {
+		if isFlagSet(name) {
+			return true
+		}
+	}
+	return false
+}
+
+func isFlagSet(name string) bool {
+	return isFlagSetIn(flag.CommandLine, name)
+}
+
+// isFlagSet for the flag set of the command
+func isFlagSetIn(fs *flag.FlagSet, name string) bool {
+	set := false
+	fs.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			set = true
+		}
+	})
+	return set
+}
+
+// subcommands, run by "akari NAME [Options] ..."
+var commands = map[string]func(args []string) error{
+	"persist":    runPersist,
+	"daemon":     runDaemon,
+	"setup-udev": runSetupUdev,
+	"auto":       runAuto,
+	"simulate":   runSimulate,
+	"schedule":   runSchedule,
+	"alarm":      runAlarm,
+}
+
 func run() error {
+	if len(os.Args) > 1 {
+		if command, ok := commands[os.Args[1]]; ok {
+			return command(os.Args[2:])
+		}
+	}
+
 	var usageWriter io.Writer = os.Stderr
 	usage := makeUsage(&usageWriter)
 	flag.Usage = usage
 
 	flag.Parse()
+	// accept "-inc 5" as well as "-inc=5", and continue to parse the rest
+	if flag.NArg() != 0 && (opt.inc.set || opt.dec.set) {
+		step := &opt.inc
+		if opt.dec.set {
+			step = &opt.dec
+		}
+		if err := step.Set(flag.Arg(0)); err != nil {
+			return err
+		}
+		if err := flag.CommandLine.Parse(flag.Args()[1:]); err != nil {
+			return err
+		}
+	}
 	if flag.NArg() != 0 {
 		flag.Usage()
 		return fmt.Errorf("invalid arguments: %v", flag.Args())
 	}
 
+	if err := useSysfs("/sys", opt.logind); err != nil {
+		return err
+	}
+
+	order, err := brightness.ParseOrder(opt.order)
+	if err != nil {
+		return err
+	}
+
 	switch {
 	case opt.help:
 		usageWriter = os.Stdout
@@ -150,16 +506,52 @@ func run() error {
 	case opt.version:
 		_, err := fmt.Printf("%s %s\n", Name, Version)
 		return err
-	case opt.list || flag.NFlag() == 0:
-		return printState()
+	case opt.list || !isAnyFlagSet(actionFlags...):
+		devices, err := brightness.ReadDeviceAllOrder(order)
+		if err != nil {
+			return err
+		}
+		return printState(devices...)
+	case opt.save != "":
+		return save(opt.save)
+	case opt.restore != "":
+		return restore(opt.restore)
+	}
+
+	// talk to the daemon if running
+	if req, ok := daemonRequest(); ok && !opt.direct {
+		if c, err := client.Dial(opt.socket); err == nil {
+			defer c.Close()
+			return runClient(c, req)
+		}
 	}
 
-	device, err := brightness.ReadDeviceIndex(opt.index)
+	device, err := brightness.ReadDeviceIndexOrder(opt.index, order)
 	if err != nil {
 		return err
 	}
+	if opt.curve != "" {
+		curve, err := parseCurve(opt.curve)
+		if err != nil {
+			return err
+		}
+		device.SetCurve(curve)
+	}
+	if opt.force {
+		device.SetPolicy(brightness.NoPolicy())
+	}
+	if opt.verify {
+		device.EnableVerify(opt.retry, 50*time.Millisecond)
+	}
 
 	switch {
+	case opt.get && opt.percent:
+		p, err := device.Percent()
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Printf("%.2f\n", p)
+		return err
 	case opt.get:
 		i, err := device.Current()
 		if err != nil {
@@ -170,31 +562,44 @@ func run() error {
 	case opt.getmax:
 		_, err := fmt.Println(device.Max())
 		return err
+	case opt.watch:
+		return watch(device)
 	}
 
 	switch {
 	case opt.set != "":
-		switch opt.set {
-		case "max":
-			return device.SetMax()
-		case "mid":
-			return device.SetMid()
-		case "min":
-			return device.SetMin()
-		default:
-			i, err := strconv.Atoi(opt.set)
-			if err != nil {
-				return err
-			}
-			if i < 0 {
-				return errors.New("can not set negative number " + opt.set)
-			}
-			return device.Set(uint(i), false)
-		}
-	case opt.inc:
-		return device.Inc10Percent()
-	case opt.dec:
-		return device.Dec10Percent()
+		// same as the daemon
+		target, err := daemon.ParseValue(device, opt.set)
+		if err != nil {
+			return err
+		}
+		if opt.fade > 0 {
+			return fadeTo(device, target)
+		}
+		return device.Set(target, opt.force)
+	case opt.off:
+		return powerOff(device)
+	case opt.on:
+		return powerOn(device)
+	case opt.togglePower:
+		powered, err := device.Powered()
+		if err != nil {
+			return err
+		}
+		if powered {
+			return powerOff(device)
+		}
+		return powerOn(device)
+	case opt.inc.set || opt.dec.set:
+		delta := opt.inc.delta
+		if opt.dec.set {
+			delta = opt.dec.delta
+			delta.Value = -delta.Value
+		}
+		if opt.fade > 0 {
+			return fadeStep(device, delta)
+		}
+		return device.Step(delta)
 	default:
 		return errors.New("arguments not enough")
 	}
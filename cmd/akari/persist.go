@@ -0,0 +1,46 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/yaeshimo/brightness"
+)
+
+// akari persist save|load
+func runPersist(args []string) error {
+	fs := flag.NewFlagSet(Name+" persist", flag.ContinueOnError)
+	fs.SetOutput(os.Stderr)
+	dir := fs.String("state-dir", brightness.DefaultStateDir, "Directory to store the brightness")
+	sysfs := fs.String("sysfs", "/sys", "Root of sysfs")
+	logind := logindFlag(fs)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage:\n")
+		fmt.Fprintf(fs.Output(), "  %s persist [Options] save|load\n", Name)
+		fmt.Fprintf(fs.Output(), "\n")
+		fmt.Fprintf(fs.Output(), "Options:\n")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return fmt.Errorf("invalid arguments: %v", fs.Args())
+	}
+	if err := useSysfs(*sysfs, *logind); err != nil {
+		return err
+	}
+	p := &brightness.Persister{Dir: *dir}
+	switch fs.Arg(0) {
+	case "save":
+		return p.Save()
+	case "load":
+		return p.Load()
+	default:
+		fs.Usage()
+		return errors.New("unknown persist command " + fs.Arg(0))
+	}
+}
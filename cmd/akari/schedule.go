@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/yaeshimo/brightness"
+)
+
+// akari schedule
+func runSchedule(args []string) error {
+	fs := flag.NewFlagSet(Name+" schedule", flag.ContinueOnError)
+	fs.SetOutput(os.Stderr)
+	lat := fs.Float64("lat", 0, "Latitude in degrees, north is positive")
+	lon := fs.Float64("lon", 0, "Longitude in degrees, east is positive")
+	day := fs.String("day", "100%", "Brightness in the day [NUMBER%]")
+	night := fs.String("night", "30%", "Brightness in the night [NUMBER%]")
+	morning := fs.String("morning", "dawn..sunrise", "Transition from night to day [EVENT[+-OFFSET]..EVENT[+-OFFSET]]")
+	evening := fs.String("evening", "sunset..dusk", "Transition from day to night, EVENT is dawn, sunrise, noon, sunset or dusk")
+	interval := fs.Duration("interval", time.Minute, "Interval of updating brightness")
+	fade := fs.Duration("fade", time.Second, "Fade duration of each update")
+	pat := fs.String("pat", "", "Select devices by the pattern of name, -index if empty")
+	index := fs.Int("index", 0, "Specify device index")
+	times := fs.Bool("times", false, "Print times of the sun today and exit")
+	sysfs := fs.String("sysfs", "/sys", "Root of sysfs")
+	logind := logindFlag(fs)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage:\n")
+		fmt.Fprintf(fs.Output(), "  %s schedule -lat NUMBER -lon NUMBER [Options]\n", Name)
+		fmt.Fprintf(fs.Output(), "\n")
+		fmt.Fprintf(fs.Output(), "Options:\n")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 0 {
+		fs.Usage()
+		return fmt.Errorf("invalid arguments: %v", fs.Args())
+	}
+	if !isFlagSetIn(fs, "lat") || !isFlagSetIn(fs, "lon") {
+		fs.Usage()
+		return errors.New("-lat and -lon are required")
+	}
+	if err := useSysfs(*sysfs, *logind); err != nil {
+		return err
+	}
+
+	s, err := brightness.NewSchedule(*lat, *lon)
+	if err != nil {
+		return err
+	}
+	if *times {
+		sun, err := brightness.Sun(time.Now(), *lat, *lon)
+		if err != nil {
+			return err
+		}
+		for _, e := range []brightness.SunEvent{brightness.Dawn, brightness.Sunrise, brightness.Noon, brightness.Sunset, brightness.Dusk} {
+			t := sun.Time(e)
+			if t.IsZero() {
+				fmt.Printf("%s -\n", e)
+				continue
+			}
+			fmt.Printf("%s %s\n", e, t.Format("15:04"))
+		}
+		return nil
+	}
+	if s.Day, err = parsePercent(*day); err != nil {
+		return err
+	}
+	if s.Night, err = parsePercent(*night); err != nil {
+		return err
+	}
+	if s.Morning, err = brightness.ParseWindow(*morning); err != nil {
+		return err
+	}
+	if s.Evening, err = brightness.ParseWindow(*evening); err != nil {
+		return err
+	}
+	s.Interval = *interval
+	s.Fade = *fade
+
+	var devices []*brightness.Device
+	if *pat != "" {
+		devices, err = brightness.ReadDevicePat(*pat)
+	} else {
+		var device *brightness.Device
+		device, err = brightness.ReadDeviceIndex(*index)
+		devices = append(devices, device)
+	}
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := signalContext()
+	defer cancel()
+	if err := s.Run(ctx, devices...); err != context.Canceled {
+		return err
+	}
+	return nil
+}
+
+// parse "NUMBER%" in [0, 100]
+func parsePercent(s string) (float64, error) {
+	p, err := strconv.ParseFloat(strings.TrimSuffix(s, "%"), 64)
+	if err != nil || !strings.HasSuffix(s, "%") || p < 0 || p > 100 {
+		return 0, errors.New("invalid percentage " + s)
+	}
+	return p, nil
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/yaeshimo/brightness"
+)
+
+// akari simulate FILE
+func runSimulate(args []string) error {
+	fs := flag.NewFlagSet(Name+" simulate", flag.ContinueOnError)
+	fs.SetOutput(os.Stderr)
+	configure := autoFlags(fs)
+	max := fs.Uint("max", 100, "Max brightness of the simulated device")
+	current := fs.Uint("current", 50, "Initial brightness of the simulated device")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage:\n")
+		fmt.Fprintf(fs.Output(), "  %s simulate [Options] FILE\n", Name)
+		fmt.Fprintf(fs.Output(), "\n")
+		fmt.Fprintf(fs.Output(), "FILE is the CSV of \"TIME,LUX\" lines, TIME is the seconds or RFC 3339 timestamp.\n")
+		fmt.Fprintf(fs.Output(), "Print the timeline of \"SECONDS,LUX,BRIGHTNESS,PERCENT\" and the summary.\n")
+		fmt.Fprintf(fs.Output(), "\n")
+		fmt.Fprintf(fs.Output(), "Options:\n")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return fmt.Errorf("invalid arguments: %v", fs.Args())
+	}
+
+	f, err := os.Open(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	trace, err := brightness.ReadLuxTrace(f)
+	if err != nil {
+		return err
+	}
+	device, err := brightness.NewMemoryDevice("simulate", *current, *max)
+	if err != nil {
+		return err
+	}
+	a := brightness.NewAutoController(device, nil)
+	if err := configure(a); err != nil {
+		return err
+	}
+	result, err := a.Simulate(trace)
+	if err != nil {
+		return err
+	}
+
+	fmt.Println("seconds,lux,brightness,percent")
+	for _, s := range result.Timeline {
+		fmt.Printf("%g,%g,%d,%.2f\n", s.Time.Seconds(), s.Lux, s.Brightness, s.Percent)
+	}
+	fmt.Printf("# writes %d\n", result.Writes)
+	fmt.Printf("# max jump %.2f%%\n", result.MaxJump)
+	_, err = fmt.Printf("# settle %s\n", result.Settle)
+	return err
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/yaeshimo/brightness"
+)
+
+// akari setup-udev
+func runSetupUdev(args []string) error {
+	fs := flag.NewFlagSet(Name+" setup-udev", flag.ContinueOnError)
+	fs.SetOutput(os.Stderr)
+	group := fs.String("group", "video", "Group permitted to write the brightness")
+	dir := fs.String("dir", "", "Write the rules to the DIR e.g. /etc/udev/rules.d, print if empty")
+	sysfs := fs.String("sysfs", "/sys", "Root of sysfs")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage:\n")
+		fmt.Fprintf(fs.Output(), "  %s setup-udev [Options]\n", Name)
+		fmt.Fprintf(fs.Output(), "\n")
+		fmt.Fprintf(fs.Output(), "Options:\n")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 0 {
+		fs.Usage()
+		return fmt.Errorf("invalid arguments: %v", fs.Args())
+	}
+	if err := useSysfs(*sysfs, "never"); err != nil {
+		return err
+	}
+
+	devices, err := brightness.ReadDeviceAll()
+	if err != nil {
+		return err
+	}
+	rules, err := brightness.UdevRules(devices, *group)
+	if err != nil {
+		return err
+	}
+	if *dir == "" {
+		if _, err := fmt.Print(rules); err != nil {
+			return err
+		}
+		file := filepath.Join("/etc/udev/rules.d", brightness.UdevRulesFile)
+		fmt.Fprintf(os.Stderr, "\n")
+		fmt.Fprintf(os.Stderr, "To install the rules:\n")
+		fmt.Fprintf(os.Stderr, "  Save the rules to %s\n", file)
+		fmt.Fprintf(os.Stderr, "  $ %s setup-udev -group %s | sudo tee %s >/dev/null\n", Name, *group, file)
+		fmt.Fprintf(os.Stderr, "\n")
+		printUdevSteps(*group)
+		return nil
+	}
+	file := filepath.Join(*dir, brightness.UdevRulesFile)
+	if err := ioutil.WriteFile(file, []byte(rules), 0644); err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "Wrote %s\n", file)
+	fmt.Fprintf(os.Stderr, "\n")
+	fmt.Fprintf(os.Stderr, "To finish the setup:\n")
+	printUdevSteps(*group)
+	return nil
+}
+
+// the steps after installing the rules
+func printUdevSteps(group string) {
+	fmt.Fprintf(os.Stderr, "  Add the user to the group, then log in again\n")
+	fmt.Fprintf(os.Stderr, "  $ sudo usermod -aG %s $USER\n", group)
+	fmt.Fprintf(os.Stderr, "\n")
+	fmt.Fprintf(os.Stderr, "  Reload the rules and apply to the present devices\n")
+	fmt.Fprintf(os.Stderr, "  $ sudo udevadm control --reload\n")
+	fmt.Fprintf(os.Stderr, "  $ sudo udevadm trigger --action=add --subsystem-match=backlight --subsystem-match=leds\n")
+}
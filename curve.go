@@ -0,0 +1,150 @@
+package brightness
+
+import (
+	"errors"
+	"math"
+	"sort"
+)
+
+// Curve maps between the perceived brightness and the raw brightness,
+// both are fraction in [0, 1].
+type Curve interface {
+	// ToRaw maps the perceived brightness to the raw brightness.
+	ToRaw(perceived float64) float64
+
+	// FromRaw is the inverse of ToRaw.
+	FromRaw(raw float64) float64
+}
+
+// Controller may implement Scaler to report the sysfs scale attribute,
+// "linear", "non-linear" or "unknown".
+type Scaler interface {
+	Scale() (string, error)
+}
+
+type linearCurve struct{}
+
+func (linearCurve) ToRaw(p float64) float64   { return clamp01(p) }
+func (linearCurve) FromRaw(r float64) float64 { return clamp01(r) }
+
+// LinearCurve treats the raw brightness as perceived.
+var LinearCurve Curve = linearCurve{}
+
+type gammaCurve float64
+
+func (g gammaCurve) ToRaw(p float64) float64   { return math.Pow(clamp01(p), float64(g)) }
+func (g gammaCurve) FromRaw(r float64) float64 { return math.Pow(clamp01(r), 1/float64(g)) }
+
+// GammaCurve returns the curve raw = perceived^gamma.
+func GammaCurve(gamma float64) (Curve, error) {
+	if !(gamma > 0) || math.IsInf(gamma, 0) {
+		return nil, errors.New("gamma must be positive")
+	}
+	return gammaCurve(gamma), nil
+}
+
+type cieCurve struct{}
+
+// CIE standard constants
+const (
+	cieEpsilon = 216.0 / 24389
+	cieKappa   = 24389.0 / 27
+)
+
+// CIE 1976 lightness, perceived is L*/100 and raw is relative luminance Y
+func (cieCurve) ToRaw(p float64) float64 {
+	l := clamp01(p) * 100
+	if l > 8 {
+		return math.Pow((l+16)/116, 3)
+	}
+	return l / cieKappa
+}
+
+func (cieCurve) FromRaw(r float64) float64 {
+	y := clamp01(r)
+	if y > cieEpsilon {
+		return clamp01((116*math.Cbrt(y) - 16) / 100)
+	}
+	return y * cieKappa / 100
+}
+
+// CIELCurve is the CIE L* lightness, suitable for the raw brightness that is linear in luminance.
+var CIELCurve Curve = cieCurve{}
+
+// [perceived, raw]
+type tableCurve [][2]float64
+
+func (t tableCurve) ToRaw(p float64) float64   { return t.lookup(clamp01(p), 0, 1) }
+func (t tableCurve) FromRaw(r float64) float64 { return t.lookup(clamp01(r), 1, 0) }
+
+// piecewise linear interpolation from the column in to the column out
+func (t tableCurve) lookup(x float64, in, out int) float64 {
+	i := sort.Search(len(t), func(i int) bool { return t[i][in] >= x })
+	switch {
+	case i == 0:
+		return t[0][out]
+	case i == len(t):
+		return t[len(t)-1][out]
+	}
+	a, b := t[i-1], t[i]
+	return a[out] + (b[out]-a[out])*(x-a[in])/(b[in]-a[in])
+}
+
+// TableCurve returns the curve interpolated from the points of [perceived, raw].
+// points must start with perceived 0, end with perceived 1,
+// and be strictly increasing in both perceived and raw.
+func TableCurve(points [][2]float64) (Curve, error) {
+	if len(points) < 2 {
+		return nil, errors.New("table curve requires at least 2 points")
+	}
+	if points[0][0] != 0 || points[len(points)-1][0] != 1 {
+		return nil, errors.New("table curve must start with perceived 0 and end with perceived 1")
+	}
+	for i, p := range points {
+		if p[1] < 0 || p[1] > 1 {
+			return nil, errors.New("table curve raw must be in [0, 1]")
+		}
+		if i > 0 && (p[0] <= points[i-1][0] || p[1] <= points[i-1][1]) {
+			return nil, errors.New("table curve must be strictly increasing")
+		}
+	}
+	return tableCurve(append([][2]float64(nil), points...)), nil
+}
+
+func clamp01(f float64) float64 {
+	switch {
+	case f < 0:
+		return 0
+	case f > 1:
+		return 1
+	}
+	return f
+}
+
+// SetCurve sets the curve used by the percentage operations.
+// nil resets to the default.
+func (d *Device) SetCurve(c Curve) { d.curve = c }
+
+// Curve returns the curve of the device.
+// The default is CIELCurve if the device reports the linear scale, otherwise LinearCurve.
+func (d *Device) Curve() Curve {
+	if d.curve != nil {
+		return d.curve
+	}
+	if s, ok := d.internal.(Scaler); ok {
+		if scale, err := s.Scale(); err == nil && scale == "linear" {
+			return CIELCurve
+		}
+	}
+	return LinearCurve
+}
+
+// perceived brightness of the raw value
+func (d *Device) toPerceived(raw uint) float64 {
+	return d.Curve().FromRaw(float64(raw) / float64(d.max))
+}
+
+// raw value of the perceived brightness, rounded to nearest
+func (d *Device) toRaw(perceived float64) uint {
+	return d.RawOf(perceived*100, RoundNearest)
+}
@@ -0,0 +1,14 @@
+// +build !windows
+
+package daemon
+
+import (
+	"os"
+	"syscall"
+)
+
+// the file is owned by the user
+func owned(fi os.FileInfo) bool {
+	st, ok := fi.Sys().(*syscall.Stat_t)
+	return ok && int(st.Uid) == os.Getuid()
+}
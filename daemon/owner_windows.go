@@ -0,0 +1,10 @@
+package daemon
+
+import (
+	"os"
+)
+
+// the temporary directory is already of the user
+func owned(fi os.FileInfo) bool {
+	return true
+}
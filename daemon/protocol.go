@@ -0,0 +1,131 @@
+// package daemon provides the akari daemon that keeps devices open
+// and serves line-delimited JSON requests on a Unix socket.
+//
+// Each request is a JSON object in a line, and the response is a JSON
+// object in a line with the same ID. After "subscribe" the connection also
+// receives events as JSON objects in lines that have Event field.
+//
+//	{"id":1,"method":"list"}
+//	{"id":2,"method":"get","device":"intel_backlight"}
+//	{"id":3,"method":"set","value":"50%"}
+//	{"id":4,"method":"step","delta":"-5%"}
+//	{"id":5,"method":"fade","value":"max","duration":"300ms","easing":"ease-in-out"}
+//	{"id":6,"method":"subscribe"}
+//	{"id":7,"method":"alarm","at":"2006-01-02T07:00:00+09:00","duration":"20m","value":"100%"}
+//	{"id":8,"method":"cancel"}
+package daemon
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/yaeshimo/brightness"
+)
+
+// methods of Request
+const (
+	MethodList      = "list"
+	MethodGet       = "get"
+	MethodSet       = "set"
+	MethodStep      = "step"
+	MethodFade      = "fade"
+	MethodSubscribe = "subscribe"
+	MethodAlarm     = "alarm"
+	MethodCancel    = "cancel"
+)
+
+// Request is a line from the client.
+type Request struct {
+	ID     int    `json:"id"`
+	Method string `json:"method"`
+
+	// target device by name, or by index if empty
+	Device string `json:"device,omitempty"`
+	Index  int    `json:"index,omitempty"`
+
+	// for set, fade and alarm, "NUMBER", "NUMBER%", "max", "mid" or "min"
+	Value string `json:"value,omitempty"`
+
+	// for step and fade, see brightness.ParseDelta
+	Delta string `json:"delta,omitempty"`
+
+	// for fade, and the ramp of alarm, see time.ParseDuration
+	Duration string `json:"duration,omitempty"`
+
+	// for alarm, the end of the ramp in RFC 3339
+	At string `json:"at,omitempty"`
+
+	// for fade, "linear", "ease-in-out" or "exponential"
+	Easing string `json:"easing,omitempty"`
+
+	// ignore the Policy of the device
+	Force bool `json:"force,omitempty"`
+}
+
+// Response is a line to the client for the Request of the same ID.
+type Response struct {
+	ID    int    `json:"id"`
+	Error string `json:"error,omitempty"`
+
+	// for list
+	Devices []brightness.DeviceState `json:"devices,omitempty"`
+
+	// the state of the target device after the request
+	State   *brightness.DeviceState `json:"state,omitempty"`
+	Percent float64                 `json:"percent,omitempty"`
+}
+
+// event kinds
+const (
+	EventChange = "change"
+)
+
+// Event is a line to the subscribed client.
+type Event struct {
+	Event string                 `json:"event"`
+	State brightness.DeviceState `json:"state"`
+
+	// "software" for the writes by the daemon,
+	// "hardware" for the changes by the hardware itself, see brightness.Source
+	Source string `json:"source,omitempty"`
+}
+
+// Easings are the names of the easings for Request.
+var Easings = map[string]brightness.Easing{
+	"":            brightness.Linear,
+	"linear":      brightness.Linear,
+	"ease-in-out": brightness.EaseInOut,
+	"exponential": brightness.Exponential,
+}
+
+// RuntimeDir returns "$XDG_RUNTIME_DIR", or the directory "akari-UID" in the temporary directory
+// that is created only for the user, so the others can not plant the files in it.
+func RuntimeDir() (string, error) {
+	if dir := os.Getenv("XDG_RUNTIME_DIR"); dir != "" {
+		return dir, nil
+	}
+	dir := filepath.Join(os.TempDir(), fmt.Sprintf("akari-%d", os.Getuid()))
+	if err := os.Mkdir(dir, 0700); err != nil && !os.IsExist(err) {
+		return "", err
+	}
+	fi, err := os.Lstat(dir)
+	if err != nil {
+		return "", err
+	}
+	if !fi.IsDir() || fi.Mode().Perm() != 0700 || !owned(fi) {
+		return "", errors.New(dir + " is not the private directory of the user")
+	}
+	return dir, nil
+}
+
+// DefaultSocket returns the default path of the socket, "akari.sock" in RuntimeDir,
+// or "" if RuntimeDir is not available.
+func DefaultSocket() string {
+	dir, err := RuntimeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "akari.sock")
+}
@@ -0,0 +1,572 @@
+package daemon
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/yaeshimo/brightness"
+)
+
+// Server serves the requests for the devices.
+type Server struct {
+	devices []*device
+
+	mu     sync.Mutex
+	ln     net.Listener
+	conns  map[*conn]bool
+	closed bool
+
+	// stop watching the devices
+	cancel context.CancelFunc
+}
+
+// device with the serialized writes
+type device struct {
+	*brightness.Device
+
+	// held while writing
+	op sync.Mutex
+
+	// cancel the running fade and the waiting alarm
+	// the pointers identify the owners to clear them
+	fadeMu sync.Mutex
+	cancel *context.CancelFunc
+	alarm  *context.CancelFunc
+
+	// the writes of the daemon, that are not notified again by watch
+	writeMu sync.Mutex
+	writing bool
+	wroteAt time.Time
+	wrote   uint
+	pending bool
+}
+
+func (d *device) beginWrite() {
+	d.writeMu.Lock()
+	d.writing = true
+	d.writeMu.Unlock()
+}
+
+// remember the brightness after the write
+func (d *device) endWrite() {
+	current, err := d.Current()
+	d.writeMu.Lock()
+	defer d.writeMu.Unlock()
+	d.writing = false
+	d.wroteAt = time.Now()
+	d.wrote, d.pending = current, err == nil
+}
+
+// the change is made by the daemon itself,
+// read while writing or the first change to the written brightness
+func (d *device) own(c brightness.Change) bool {
+	d.writeMu.Lock()
+	defer d.writeMu.Unlock()
+	if d.writing || c.Time.Before(d.wroteAt) {
+		return true
+	}
+	pending := d.pending
+	d.pending = false
+	return pending && c.New == d.wrote
+}
+
+// stop the running fade if exists
+func (d *device) stopFade() {
+	d.fadeMu.Lock()
+	cancel := d.cancel
+	d.fadeMu.Unlock()
+	if cancel != nil {
+		(*cancel)()
+	}
+}
+
+// stop the alarm if exists
+func (d *device) stopAlarm() {
+	d.fadeMu.Lock()
+	cancel := d.alarm
+	d.fadeMu.Unlock()
+	if cancel != nil {
+		(*cancel)()
+	}
+}
+
+// start the fade that is stopped by the following writes, call done after the fade
+func (d *device) startFade(ctx context.Context) (context.Context, func()) {
+	d.stopFade()
+	ctx, cancel := context.WithCancel(ctx)
+	d.fadeMu.Lock()
+	d.cancel = &cancel
+	d.fadeMu.Unlock()
+	return ctx, func() {
+		cancel()
+		d.fadeMu.Lock()
+		if d.cancel == &cancel {
+			d.cancel = nil
+		}
+		d.fadeMu.Unlock()
+	}
+}
+
+// NewServer returns the Server for the devices, or ReadDeviceAll if devices are not provided.
+func NewServer(devices ...*brightness.Device) (*Server, error) {
+	if len(devices) == 0 {
+		var err error
+		devices, err = brightness.ReadDeviceAll()
+		if err != nil {
+			return nil, err
+		}
+	}
+	s := &Server{conns: make(map[*conn]bool)}
+	for _, d := range devices {
+		s.devices = append(s.devices, &device{Device: d})
+	}
+	return s, nil
+}
+
+// Listen listens on the Unix socket at the path.
+// The stale socket file left by the dead daemon is removed, but the other files are not.
+// The empty path is the DefaultSocket that is not available.
+func Listen(path string) (net.Listener, error) {
+	if path == "" {
+		if _, err := RuntimeDir(); err != nil {
+			return nil, err
+		}
+		return nil, errors.New("socket path is empty")
+	}
+	if c, err := net.Dial("unix", path); err == nil {
+		c.Close()
+		return nil, errors.New("daemon is already running on " + path)
+	}
+	if fi, err := os.Lstat(path); err == nil {
+		if fi.Mode()&os.ModeSocket == 0 {
+			return nil, errors.New(path + " is not a socket")
+		}
+		if err := os.Remove(path); err != nil {
+			return nil, err
+		}
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	}
+	return net.Listen("unix", path)
+}
+
+// Serve accepts the connections on the listener until Close.
+func (s *Server) Serve(ln net.Listener) error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return errors.New("server closed")
+	}
+	s.ln = ln
+	ctx, cancel := context.WithCancel(context.Background())
+	s.cancel = cancel
+	s.mu.Unlock()
+	for _, d := range s.devices {
+		go s.watch(ctx, d)
+	}
+	for {
+		c, err := ln.Accept()
+		if err != nil {
+			s.mu.Lock()
+			closed := s.closed
+			s.mu.Unlock()
+			if closed {
+				return nil
+			}
+			return err
+		}
+		go s.serveConn(c)
+	}
+}
+
+// Close stops the Serve and closes all connections.
+func (s *Server) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closed = true
+	for c := range s.conns {
+		c.Close()
+	}
+	for _, d := range s.devices {
+		d.stopAlarm()
+		d.stopFade()
+	}
+	if s.cancel != nil {
+		s.cancel()
+	}
+	if s.ln != nil {
+		return s.ln.Close()
+	}
+	return nil
+}
+
+type conn struct {
+	net.Conn
+
+	// serialize the lines
+	mu  sync.Mutex
+	enc *json.Encoder
+
+	subscribed bool
+
+	// queue of the events, so the subscriber that does not read
+	// does not block the writes of the others
+	events chan *Event
+	done   chan struct{}
+}
+
+// EventQueue is the number of the queued events of each subscriber,
+// the events are dropped if the queue is full.
+var EventQueue = 16
+
+func (c *conn) send(v interface{}) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.enc.Encode(v)
+}
+
+// send the queued events until the connection is closed
+func (c *conn) sendEvents() {
+	for {
+		select {
+		case ev := <-c.events:
+			if c.send(ev) != nil {
+				return
+			}
+		case <-c.done:
+			return
+		}
+	}
+}
+
+func (s *Server) serveConn(nc net.Conn) {
+	c := &conn{
+		Conn:   nc,
+		enc:    json.NewEncoder(nc),
+		events: make(chan *Event, EventQueue),
+		done:   make(chan struct{}),
+	}
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		nc.Close()
+		return
+	}
+	s.conns[c] = true
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		delete(s.conns, c)
+		s.mu.Unlock()
+		close(c.done)
+		c.Close()
+	}()
+
+	// stop the fades of the connection before waiting them
+	ctx, cancel := context.WithCancel(context.Background())
+	var wg sync.WaitGroup
+	defer func() {
+		cancel()
+		wg.Wait()
+	}()
+	scanner := bufio.NewScanner(c)
+	for scanner.Scan() {
+		var req Request
+		if err := json.Unmarshal(scanner.Bytes(), &req); err != nil {
+			if c.send(&Response{Error: "invalid request: " + err.Error()}) != nil {
+				return
+			}
+			continue
+		}
+		// fade and alarm take long, do not block the following requests
+		if req.Method == MethodFade || req.Method == MethodAlarm {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				c.send(s.handle(ctx, c, &req))
+			}()
+			continue
+		}
+		if c.send(s.handle(ctx, c, &req)) != nil {
+			return
+		}
+	}
+}
+
+func (s *Server) handle(ctx context.Context, c *conn, req *Request) *Response {
+	resp, err := s.do(ctx, c, req)
+	if err != nil {
+		return &Response{ID: req.ID, Error: err.Error()}
+	}
+	resp.ID = req.ID
+	return resp
+}
+
+func (s *Server) do(ctx context.Context, c *conn, req *Request) (*Response, error) {
+	switch req.Method {
+	case MethodList:
+		resp := &Response{Devices: make([]brightness.DeviceState, 0, len(s.devices))}
+		for _, d := range s.devices {
+			state, err := d.State()
+			if err != nil {
+				return nil, err
+			}
+			resp.Devices = append(resp.Devices, state)
+		}
+		return resp, nil
+	case MethodSubscribe:
+		s.mu.Lock()
+		if !c.subscribed {
+			c.subscribed = true
+			go c.sendEvents()
+		}
+		s.mu.Unlock()
+		return &Response{}, nil
+	}
+
+	d, err := s.device(req)
+	if err != nil {
+		return nil, err
+	}
+	switch req.Method {
+	case MethodGet:
+		return response(d)
+	case MethodCancel:
+		d.stopAlarm()
+		d.stopFade()
+		return response(d)
+	case MethodSet:
+		err = s.write(d, func() error {
+			dev := d.forced(req.Force)
+			want, err := ParseValue(dev, req.Value)
+			if err != nil {
+				return err
+			}
+			return dev.Set(want, req.Force)
+		})
+	case MethodStep:
+		err = s.write(d, func() error {
+			delta, err := brightness.ParseDelta(req.Delta)
+			if err != nil {
+				return err
+			}
+			return d.forced(req.Force).Step(delta)
+		})
+	case MethodFade:
+		err = s.fade(ctx, d, req)
+	case MethodAlarm:
+		err = s.alarm(ctx, d, req)
+	default:
+		return nil, errors.New("unknown method " + strconv.Quote(req.Method))
+	}
+	if err != nil {
+		return nil, err
+	}
+	s.notify(d, brightness.SourceSoftware)
+	return response(d)
+}
+
+func response(d *device) (*Response, error) {
+	state, err := d.State()
+	if err != nil {
+		return nil, err
+	}
+	return &Response{State: &state, Percent: d.PercentOf(state.Current)}, nil
+}
+
+// find the target device of the request
+func (s *Server) device(req *Request) (*device, error) {
+	if req.Device != "" {
+		for _, d := range s.devices {
+			if d.Name() == req.Device {
+				return d, nil
+			}
+		}
+		return nil, errors.New("not found device " + strconv.Quote(req.Device))
+	}
+	if req.Index < 0 || req.Index >= len(s.devices) {
+		return nil, errors.New("invalid index " + strconv.Itoa(req.Index))
+	}
+	return s.devices[req.Index], nil
+}
+
+// serialize the write f, the running fade is stopped
+func (s *Server) write(d *device, f func() error) error {
+	d.stopFade()
+	return s.locked(d, f)
+}
+
+func (s *Server) locked(d *device, f func() error) error {
+	d.op.Lock()
+	defer d.op.Unlock()
+	d.beginWrite()
+	defer d.endWrite()
+	return f()
+}
+
+// the Device without the Policy if force,
+// the copy is returned so the shared Device is not changed for the others
+func (d *device) forced(force bool) *brightness.Device {
+	if !force {
+		return d.Device
+	}
+	dev := *d.Device
+	dev.SetPolicy(brightness.NoPolicy())
+	return &dev
+}
+
+// the fade is stopped by the following writes to the device or closing the connection
+func (s *Server) fade(ctx context.Context, d *device, req *Request) error {
+	duration, err := time.ParseDuration(req.Duration)
+	if err != nil {
+		return err
+	}
+	easing, ok := Easings[req.Easing]
+	if !ok {
+		return errors.New("invalid easing " + strconv.Quote(req.Easing))
+	}
+	if (req.Value == "") == (req.Delta == "") {
+		return errors.New("fade requires either value or delta")
+	}
+
+	ctx, done := d.startFade(ctx)
+	defer done()
+	return s.locked(d, func() error {
+		// canceled by the following writes while waiting
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		dev := d.forced(req.Force)
+		if req.Delta != "" {
+			// limited as same as step
+			delta, err := brightness.ParseDelta(req.Delta)
+			if err != nil {
+				return err
+			}
+			return dev.FadeStep(ctx, delta, duration, easing)
+		}
+		target, err := ParseValue(dev, req.Value)
+		if err != nil {
+			return err
+		}
+		return dev.FadeTo(ctx, target, duration, easing)
+	})
+}
+
+// the alarm replaces the previous one of the device, and is stopped by cancel or closing the connection.
+// While waiting the writes do not stop it, and the ramp is stopped by the writes as same as the fade.
+func (s *Server) alarm(ctx context.Context, d *device, req *Request) error {
+	at, err := time.Parse(time.RFC3339, req.At)
+	if err != nil {
+		return errors.New("invalid alarm time " + strconv.Quote(req.At))
+	}
+	ramp, err := time.ParseDuration(req.Duration)
+	if err != nil {
+		return err
+	}
+	if ramp < 0 {
+		return errors.New("ramp must not be negative")
+	}
+	if req.Value == "" {
+		return errors.New("alarm requires value")
+	}
+	target, err := ParseValue(d.Device, req.Value)
+	if err != nil {
+		return err
+	}
+	a := &brightness.Alarm{At: at, Ramp: ramp, Target: target}
+	if err := a.Check(d.Device); err != nil {
+		return err
+	}
+
+	d.stopAlarm()
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	d.fadeMu.Lock()
+	d.alarm = &cancel
+	d.fadeMu.Unlock()
+	defer func() {
+		d.fadeMu.Lock()
+		if d.alarm == &cancel {
+			d.alarm = nil
+		}
+		d.fadeMu.Unlock()
+	}()
+
+	if err := a.Wait(ctx); err != nil {
+		return err
+	}
+	ctx, done := d.startFade(ctx)
+	defer done()
+	return s.locked(d, func() error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		return a.Raise(ctx, d.Device)
+	})
+}
+
+// notify the changes by others, e.g. the hardware itself, other tools or the desktop,
+// the changes by the daemon are notified by the writes
+func (s *Server) watch(ctx context.Context, d *device) {
+	for c := range d.Watch(ctx) {
+		if !d.own(c) {
+			s.notify(d, c.Source)
+		}
+	}
+}
+
+// queue the change event for the subscribers, dropped for the subscriber of the full queue
+func (s *Server) notify(d *device, source brightness.Source) {
+	state, err := d.State()
+	if err != nil {
+		return
+	}
+	s.mu.Lock()
+	var subscribers []*conn
+	for c := range s.conns {
+		if c.subscribed {
+			subscribers = append(subscribers, c)
+		}
+	}
+	s.mu.Unlock()
+	ev := &Event{Event: EventChange, State: state, Source: source.String()}
+	for _, c := range subscribers {
+		select {
+		case c.events <- ev:
+		default:
+		}
+	}
+}
+
+// ParseValue parses "NUMBER", "NUMBER%", "max", "mid" or "min" of Request.Value for the device.
+func ParseValue(d *brightness.Device, s string) (uint, error) {
+	switch s {
+	case "max":
+		return d.Cap(), nil
+	case "mid":
+		return d.Mid(), nil
+	case "min":
+		return d.Min(), nil
+	}
+	if strings.HasSuffix(s, "%") {
+		p, err := strconv.ParseFloat(strings.TrimSuffix(s, "%"), 64)
+		if err != nil || p < 0 || p > 100 {
+			return 0, errors.New("invalid value " + strconv.Quote(s))
+		}
+		return d.RawOf(p, brightness.RoundNearest), nil
+	}
+	i, err := strconv.ParseUint(s, 10, 64)
+	if err != nil {
+		return 0, errors.New("invalid value " + strconv.Quote(s))
+	}
+	return uint(i), nil
+}
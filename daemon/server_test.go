@@ -0,0 +1,513 @@
+package daemon
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/yaeshimo/brightness"
+)
+
+// for brightness.Controller
+type mock struct {
+	mu           sync.Mutex
+	name         string
+	current, max uint
+
+	// for brightness.HardwareChangeReader
+	hw      uint
+	hwValid bool
+}
+
+func (m *mock) Name() string { return m.name }
+func (m *mock) Current() (uint, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.current, nil
+}
+func (m *mock) Max() (uint, error) { return m.max, nil }
+func (m *mock) Set(ui uint) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.current = ui
+	return nil
+}
+
+func (m *mock) HardwareChanged() (uint, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if !m.hwValid {
+		return 0, brightness.ErrNoHardwareChange
+	}
+	return m.hw, nil
+}
+
+// changed by the hardware itself
+func (m *mock) hwChange(ui uint) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.current, m.hw, m.hwValid = ui, ui, true
+}
+
+// the initial state that the hardware has not changed yet
+func (m *mock) reset(current uint) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.current, m.hw, m.hwValid = current, 0, false
+}
+
+type mockBackend []*mock
+
+func (b mockBackend) Discover() ([]brightness.Controller, error) {
+	cs := make([]brightness.Controller, 0, len(b))
+	for _, m := range b {
+		cs = append(cs, m)
+	}
+	return cs, nil
+}
+
+var mocks = mockBackend{
+	{name: "mock0", current: 50, max: 100},
+	{name: "mock1", current: 5, max: 7},
+}
+
+func TestMain(m *testing.M) {
+	// only the mock devices
+	for _, name := range brightness.Backends() {
+		brightness.Unregister(name)
+	}
+	brightness.Register("mock", mocks)
+	brightness.DefaultOrder = brightness.OrderName
+	brightness.WatchInterval = time.Millisecond
+	os.Exit(m.Run())
+}
+
+// client for test
+type client struct {
+	t       *testing.T
+	c       net.Conn
+	scanner *bufio.Scanner
+}
+
+func (c *client) send(req Request) {
+	c.t.Helper()
+	b, err := json.Marshal(req)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	if _, err := c.c.Write(append(b, '\n')); err != nil {
+		c.t.Fatal(err)
+	}
+}
+
+// read a line to v
+func (c *client) read(v interface{}) {
+	c.t.Helper()
+	if !c.scanner.Scan() {
+		c.t.Fatalf("can not read the line %v", c.scanner.Err())
+	}
+	if err := json.Unmarshal(c.scanner.Bytes(), v); err != nil {
+		c.t.Fatal(err)
+	}
+}
+
+func (c *client) do(req Request) *Response {
+	c.t.Helper()
+	c.send(req)
+	resp := new(Response)
+	c.read(resp)
+	if resp.ID != req.ID {
+		c.t.Fatalf("expected id %d but %d", req.ID, resp.ID)
+	}
+	return resp
+}
+
+func startServer(t *testing.T) (socket string, stop func()) {
+	// the tests change the mocks
+	mocks[0].reset(50)
+	mocks[1].reset(5)
+
+	dir, err := ioutil.TempDir("", "TestServer")
+	if err != nil {
+		t.Fatal(err)
+	}
+	socket = filepath.Join(dir, "akari.sock")
+	s, err := NewServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ln, err := Listen(socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan error, 1)
+	go func() { done <- s.Serve(ln) }()
+	return socket, func() {
+		if err := s.Close(); err != nil {
+			t.Error(err)
+		}
+		if err := <-done; err != nil {
+			t.Error(err)
+		}
+		os.RemoveAll(dir)
+	}
+}
+
+func dial(t *testing.T, socket string) *client {
+	c, err := net.Dial("unix", socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &client{t: t, c: c, scanner: bufio.NewScanner(c)}
+}
+
+func TestServer(t *testing.T) {
+	socket, stop := startServer(t)
+	defer stop()
+
+	if _, err := Listen(socket); err == nil {
+		t.Fatal("expected error for running daemon but nil")
+	}
+
+	c := dial(t, socket)
+	defer c.c.Close()
+
+	resp := c.do(Request{ID: 1, Method: MethodList})
+	if resp.Error != "" || len(resp.Devices) != 2 || resp.Devices[1].Name != "mock1" {
+		t.Fatalf("unexpected list %+v", resp)
+	}
+
+	for _, test := range []struct {
+		req     Request
+		exp     uint
+		wanterr bool
+	}{
+		{req: Request{Method: MethodGet}, exp: 50},
+		{req: Request{Method: MethodSet, Value: "80"}, exp: 80},
+		{req: Request{Method: MethodSet, Value: "50%"}, exp: 50},
+		{req: Request{Method: MethodSet, Value: "max"}, exp: 100},
+		{req: Request{Method: MethodSet, Value: "min"}, exp: 10},
+		{req: Request{Method: MethodStep, Delta: "5%"}, exp: 15},
+		{req: Request{Method: MethodStep, Delta: "raw:-1"}, exp: 14},
+		{req: Request{Method: MethodFade, Value: "40", Duration: "10ms"}, exp: 40},
+		{req: Request{Method: MethodFade, Delta: "10", Duration: "10ms", Easing: "ease-in-out"}, exp: 50},
+		{req: Request{Method: MethodSet, Value: "0", Force: true}, exp: 0},
+		{req: Request{Method: MethodSet, Value: "50"}, exp: 50},
+		{req: Request{Method: MethodGet, Device: "mock1"}, exp: 5},
+		{req: Request{Method: MethodSet, Index: 1, Value: "max"}, exp: 7},
+
+		{req: Request{Method: MethodSet, Value: "0"}, wanterr: true},
+		{req: Request{Method: MethodSet, Value: "101"}, wanterr: true},
+		{req: Request{Method: MethodSet, Value: "string"}, wanterr: true},
+		{req: Request{Method: MethodStep, Delta: "string"}, wanterr: true},
+		{req: Request{Method: MethodFade, Value: "max"}, wanterr: true},
+		{req: Request{Method: MethodFade, Value: "max", Duration: "1ms", Easing: "string"}, wanterr: true},
+		{req: Request{Method: MethodGet, Device: "not exist"}, wanterr: true},
+		{req: Request{Method: MethodGet, Index: 2}, wanterr: true},
+		{req: Request{Method: "unknown"}, wanterr: true},
+	} {
+		test.req.ID = 2
+		resp := c.do(test.req)
+		if test.wanterr {
+			if resp.Error == "" {
+				t.Fatalf("%+v expected error but nil", test.req)
+			}
+			continue
+		}
+		if resp.Error != "" {
+			t.Fatalf("%+v %s", test.req, resp.Error)
+		}
+		if resp.State == nil || resp.State.Current != test.exp {
+			t.Fatalf("%+v exp %d but out %+v", test.req, test.exp, resp.State)
+		}
+	}
+}
+
+func TestListen(t *testing.T) {
+	dir, err := ioutil.TempDir("", "TestListen")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// not removed if not a socket
+	file := filepath.Join(dir, "file")
+	if err := ioutil.WriteFile(file, []byte("keep"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Listen(file); err == nil {
+		t.Fatal("expected error for the regular file but nil")
+	}
+	if _, err := os.Stat(file); err != nil {
+		t.Fatal(err)
+	}
+
+	// the stale socket is removed
+	socket := filepath.Join(dir, "akari.sock")
+	ln, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ln.(*net.UnixListener).SetUnlinkOnClose(false)
+	ln.Close()
+	ln, err = Listen(socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ln.Close()
+}
+
+func TestRuntimeDir(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "TestRuntimeDir")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+	defer os.Setenv("TMPDIR", os.Getenv("TMPDIR"))
+	defer os.Setenv("XDG_RUNTIME_DIR", os.Getenv("XDG_RUNTIME_DIR"))
+	os.Setenv("TMPDIR", tmp)
+	os.Setenv("XDG_RUNTIME_DIR", "")
+
+	exp := filepath.Join(tmp, fmt.Sprintf("akari-%d", os.Getuid()))
+	if out, err := RuntimeDir(); err != nil || out != exp {
+		t.Fatalf("want %s but out %s %v", exp, out, err)
+	}
+	if out := DefaultSocket(); out != filepath.Join(exp, "akari.sock") {
+		t.Fatalf("unexpected socket %s", out)
+	}
+
+	// the others can read
+	if err := os.Chmod(exp, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := RuntimeDir(); err == nil {
+		t.Fatal("expected error for the shared directory but nil")
+	}
+	if out := DefaultSocket(); out != "" {
+		t.Fatalf("expected empty socket but %s", out)
+	}
+}
+
+func TestSubscribe(t *testing.T) {
+	socket, stop := startServer(t)
+	defer stop()
+
+	sub := dial(t, socket)
+	defer sub.c.Close()
+	if resp := sub.do(Request{ID: 1, Method: MethodSubscribe}); resp.Error != "" {
+		t.Fatal(resp.Error)
+	}
+
+	c := dial(t, socket)
+	defer c.c.Close()
+	if resp := c.do(Request{ID: 1, Method: MethodSet, Device: "mock0", Value: "60"}); resp.Error != "" {
+		t.Fatal(resp.Error)
+	}
+	var ev Event
+	sub.read(&ev)
+	if ev.Event != EventChange || ev.State.Name != "mock0" || ev.State.Current != 60 || ev.Source != "software" {
+		t.Fatalf("unexpected event %+v", ev)
+	}
+
+	mocks[0].hwChange(30)
+	ev = Event{}
+	sub.read(&ev)
+	if ev.Event != EventChange || ev.State.Name != "mock0" || ev.State.Current != 30 || ev.Source != "hardware" {
+		t.Fatalf("unexpected event %+v", ev)
+	}
+
+	// written by other tools
+	mocks[1].Set(3)
+	ev = Event{}
+	sub.read(&ev)
+	if ev.Event != EventChange || ev.State.Name != "mock1" || ev.State.Current != 3 || ev.Source != "software" {
+		t.Fatalf("unexpected event %+v", ev)
+	}
+}
+
+func TestSubscribeStalled(t *testing.T) {
+	socket, stop := startServer(t)
+	defer stop()
+
+	// never reads the events
+	sub := dial(t, socket)
+	defer sub.c.Close()
+	if resp := sub.do(Request{ID: 1, Method: MethodSubscribe}); resp.Error != "" {
+		t.Fatal(resp.Error)
+	}
+
+	c := dial(t, socket)
+	defer c.c.Close()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		// more than the socket buffer
+		for i := 0; i < 10000; i++ {
+			if resp := c.do(Request{ID: 1, Method: MethodSet, Device: "mock0", Value: strconv.Itoa(10 + i%90)}); resp.Error != "" {
+				t.Error(resp.Error)
+				return
+			}
+		}
+	}()
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatal("writes are blocked by the stalled subscriber")
+	}
+}
+
+func TestFadeCanceled(t *testing.T) {
+	socket, stop := startServer(t)
+	defer stop()
+
+	c := dial(t, socket)
+	defer c.c.Close()
+	if resp := c.do(Request{ID: 1, Method: MethodSet, Value: "50"}); resp.Error != "" {
+		t.Fatal(resp.Error)
+	}
+
+	// the following step stops the fade
+	c.send(Request{ID: 2, Method: MethodFade, Value: "max", Duration: "10s"})
+	time.Sleep(50 * time.Millisecond)
+	c.send(Request{ID: 3, Method: MethodStep, Delta: "raw:1"})
+	var fade, step *Response
+	for fade == nil || step == nil {
+		resp := new(Response)
+		c.read(resp)
+		switch resp.ID {
+		case 2:
+			fade = resp
+		case 3:
+			step = resp
+		}
+	}
+	if fade.Error == "" {
+		t.Fatal("expected fade canceled but not")
+	}
+	if step.Error != "" {
+		t.Fatal(step.Error)
+	}
+	if step.State.Current >= 100 {
+		t.Fatalf("fade is not stopped %d", step.State.Current)
+	}
+}
+
+func TestFadeClosed(t *testing.T) {
+	socket, stop := startServer(t)
+	defer stop()
+
+	c := dial(t, socket)
+	if resp := c.do(Request{ID: 1, Method: MethodSet, Value: "50"}); resp.Error != "" {
+		t.Fatal(resp.Error)
+	}
+	// closing the connection stops the fade
+	c.send(Request{ID: 2, Method: MethodFade, Value: "max", Duration: "10s"})
+	time.Sleep(50 * time.Millisecond)
+	c.c.Close()
+	time.Sleep(50 * time.Millisecond)
+
+	c = dial(t, socket)
+	defer c.c.Close()
+	before := c.do(Request{ID: 3, Method: MethodGet})
+	time.Sleep(100 * time.Millisecond)
+	after := c.do(Request{ID: 4, Method: MethodGet})
+	if before.Error != "" || after.Error != "" {
+		t.Fatal(before.Error, after.Error)
+	}
+	if before.State.Current != after.State.Current || after.State.Current >= 100 {
+		t.Fatalf("fade is not stopped %d %d", before.State.Current, after.State.Current)
+	}
+}
+
+func TestForce(t *testing.T) {
+	socket, stop := startServer(t)
+	defer stop()
+
+	// the forced writes do not change the limits of the others
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		c := dial(t, socket)
+		defer c.c.Close()
+		for i := 0; i < 100; i++ {
+			if resp := c.do(Request{ID: 1, Method: MethodSet, Value: "0", Force: true}); resp.Error != "" {
+				t.Error(resp.Error)
+				return
+			}
+		}
+	}()
+	c := dial(t, socket)
+	defer c.c.Close()
+	at := time.Now().Add(time.Hour).Format(time.RFC3339)
+	for i := 0; i < 100; i++ {
+		if resp := c.do(Request{ID: 2, Method: MethodAlarm, At: at, Duration: "1m", Value: "0"}); resp.Error == "" {
+			t.Fatal("expected error for the alarm under the limit but nil")
+		}
+	}
+	<-done
+}
+
+func TestAlarm(t *testing.T) {
+	socket, stop := startServer(t)
+	defer stop()
+
+	c := dial(t, socket)
+	defer c.c.Close()
+	if resp := c.do(Request{ID: 1, Method: MethodSet, Value: "50"}); resp.Error != "" {
+		t.Fatal(resp.Error)
+	}
+
+	for _, req := range []Request{
+		{Method: MethodAlarm, At: "string", Duration: "1ms", Value: "max"},
+		{Method: MethodAlarm, At: time.Now().Format(time.RFC3339), Duration: "string", Value: "max"},
+		{Method: MethodAlarm, At: time.Now().Format(time.RFC3339), Duration: "1ms"},
+		{Method: MethodAlarm, At: time.Now().Format(time.RFC3339), Duration: "1ms", Value: "101"},
+	} {
+		req.ID = 2
+		if resp := c.do(req); resp.Error == "" {
+			t.Fatalf("%+v expected error but nil", req)
+		}
+	}
+
+	// ramp to the max
+	resp := c.do(Request{ID: 3, Method: MethodAlarm, At: time.Now().Add(200 * time.Millisecond).Format(time.RFC3339Nano), Duration: "300ms", Value: "max"})
+	if resp.Error != "" {
+		t.Fatal(resp.Error)
+	}
+	if resp.State.Current != 100 {
+		t.Fatalf("unexpected state %+v", resp.State)
+	}
+
+	// the writes do not stop the waiting alarm, but cancel does
+	c.send(Request{ID: 4, Method: MethodAlarm, At: time.Now().Add(time.Hour).Format(time.RFC3339), Duration: "20m", Value: "max"})
+	time.Sleep(50 * time.Millisecond)
+	if resp := c.do(Request{ID: 5, Method: MethodSet, Value: "60"}); resp.Error != "" {
+		t.Fatal(resp.Error)
+	}
+	c.send(Request{ID: 6, Method: MethodCancel})
+	var alarm, cancel *Response
+	for alarm == nil || cancel == nil {
+		resp := new(Response)
+		c.read(resp)
+		switch resp.ID {
+		case 4:
+			alarm = resp
+		case 6:
+			cancel = resp
+		}
+	}
+	if alarm.Error == "" {
+		t.Fatal("expected alarm canceled but not")
+	}
+	if cancel.Error != "" || cancel.State.Current != 60 {
+		t.Fatalf("unexpected cancel %+v", cancel)
+	}
+}
@@ -0,0 +1,122 @@
+package brightness
+
+import (
+	"context"
+	"math"
+	"time"
+)
+
+// Easing maps the progress of the fade in [0, 1] to the progress of the brightness in [0, 1].
+type Easing func(t float64) float64
+
+// Linear changes the brightness at constant rate.
+func Linear(t float64) float64 { return t }
+
+// EaseInOut starts and ends slowly.
+func EaseInOut(t float64) float64 { return (1 - math.Cos(math.Pi*t)) / 2 }
+
+// Exponential starts slowly and ends quickly.
+func Exponential(t float64) float64 {
+	if t <= 0 {
+		return 0
+	}
+	return math.Pow(2, 10*(t-1))
+}
+
+// FadeInterval is the interval of the intermediate writes of FadeTo.
+var FadeInterval = 16 * time.Millisecond
+
+// FadeTo changes the brightness to the target gradually over the duration.
+// easing is Linear if nil.
+// The target is limited as same as Set without force.
+// If ctx is done then the fade is stopped at the intermediate brightness and return ctx.Err().
+func (d *Device) FadeTo(ctx context.Context, target uint, duration time.Duration, easing Easing) error {
+	if err := d.check(target, false); err != nil {
+		return err
+	}
+	return d.fade(ctx, target, duration, easing)
+}
+
+// FadeStep changes the brightness by the delta gradually over the duration,
+// to the brightness that Step will set, so it is limited as same as Step.
+func (d *Device) FadeStep(ctx context.Context, delta Delta, duration time.Duration, easing Easing) error {
+	current, err := d.internal.Current()
+	if err != nil {
+		return err
+	}
+	target := d.step(current, delta)
+	if target == current {
+		return nil
+	}
+	return d.fade(ctx, target, duration, easing)
+}
+
+// without limits
+func (d *Device) fade(ctx context.Context, target uint, duration time.Duration, easing Easing) error {
+	return d.fadeClock(ctx, SystemClock, target, duration, easing)
+}
+
+// fade by the clock, the progress is computed from Now() at every step
+// so the fade ends at the time even if the steps are delayed
+func (d *Device) fadeClock(ctx context.Context, clock Clock, target uint, duration time.Duration, easing Easing) error {
+	if easing == nil {
+		easing = Linear
+	}
+	from, err := d.internal.Current()
+	if err != nil {
+		return err
+	}
+	start := clock.Now()
+	end := start.Add(duration)
+	last := from
+	for {
+		rest := end.Sub(clock.Now())
+		if rest <= 0 {
+			break
+		}
+		if rest > FadeInterval {
+			rest = FadeInterval
+		}
+		if err := sleep(ctx, clock, rest); err != nil {
+			return err
+		}
+		now := clock.Now()
+		if !now.Before(end) {
+			break
+		}
+		want := interpolate(from, target, easing(float64(now.Sub(start))/float64(duration)))
+		if want == last {
+			continue
+		}
+		if err := d.write(want); err != nil {
+			return err
+		}
+		last = want
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return d.write(target)
+}
+
+func interpolate(from, to uint, progress float64) uint {
+	if progress < 0 {
+		progress = 0
+	} else if progress > 1 {
+		progress = 1
+	}
+	return uint(math.Round(float64(from) + (float64(to)-float64(from))*progress))
+}
+
+// return ctx.Err() if ctx is done before d by the clock
+func sleep(ctx context.Context, clock Clock, d time.Duration) error {
+	if err := ctx.Err(); err != nil || d <= 0 {
+		return err
+	}
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-clock.After(d):
+		return nil
+	}
+}
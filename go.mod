@@ -0,0 +1,5 @@
+module github.com/yaeshimo/brightness
+
+go 1.16
+
+require github.com/godbus/dbus/v5 v5.1.0
@@ -0,0 +1,178 @@
+package brightness
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"math"
+	"os"
+	"sort"
+)
+
+// MaxLuxSamples is the maximum number of the samples kept by LuxModel.
+var MaxLuxSamples = 32
+
+// the samples closer than this in the logarithm of lux are the same lighting, about ±30%
+const learnRadius = 0.25
+
+// LuxModel learns the LuxCurve from the brightness chosen by the user.
+type LuxModel struct {
+	// Base is the curve before learning, DefaultLuxCurve if nil.
+	Base *LuxCurve `json:"base,omitempty"`
+
+	// Samples are [lux, percent] chosen by the user, the oldest first.
+	Samples [][2]float64 `json:"samples"`
+}
+
+// Add records the brightness in percent chosen by the user in the lux.
+// The older samples of the same lighting are replaced.
+func (m *LuxModel) Add(lux, percent float64) {
+	lux = math.Max(lux, 0)
+	percent = math.Max(0, math.Min(100, percent))
+	samples := m.Samples[:0:0]
+	for _, s := range m.Samples {
+		if math.Abs(math.Log1p(s[0])-math.Log1p(lux)) >= learnRadius {
+			samples = append(samples, s)
+		}
+	}
+	samples = append(samples, [2]float64{lux, percent})
+	if n := len(samples) - MaxLuxSamples; n > 0 {
+		samples = samples[n:]
+	}
+	m.Samples = samples
+}
+
+// Fit returns the curve passing the samples, non-decreasing in lux.
+// The conflicting samples are averaged, and the points of Base are
+// kept between the neighboring samples.
+func (m *LuxModel) Fit() (*LuxCurve, error) {
+	base := m.Base
+	if base == nil {
+		base = DefaultLuxCurve()
+	}
+	samples := append([][2]float64(nil), m.Samples...)
+	sort.SliceStable(samples, func(i, j int) bool { return samples[i][0] < samples[j][0] })
+	samples = isotonic(samples)
+
+	points := samples
+	for _, p := range base.points {
+		near := false
+		lo, hi := 0.0, 100.0
+		for _, s := range samples {
+			if math.Abs(math.Log1p(s[0])-math.Log1p(p[0])) < learnRadius {
+				near = true
+				break
+			}
+			if s[0] < p[0] {
+				lo = math.Max(lo, s[1])
+			} else {
+				hi = math.Min(hi, s[1])
+			}
+		}
+		if !near {
+			points = append(points, [2]float64{p[0], math.Max(lo, math.Min(hi, p[1]))})
+		}
+	}
+	sort.Slice(points, func(i, j int) bool { return points[i][0] < points[j][0] })
+	return NewLuxCurve(points)
+}
+
+// pool adjacent violators, the points are sorted by lux, and the same lux are merged
+func isotonic(points [][2]float64) [][2]float64 {
+	type block struct {
+		lux     []float64
+		sum     float64
+		samples int
+	}
+	var blocks []block
+	for _, p := range points {
+		blocks = append(blocks, block{lux: []float64{p[0]}, sum: p[1], samples: 1})
+		for len(blocks) > 1 {
+			a, b := blocks[len(blocks)-2], blocks[len(blocks)-1]
+			if a.sum/float64(a.samples) < b.sum/float64(b.samples) && a.lux[len(a.lux)-1] != b.lux[0] {
+				break
+			}
+			blocks = append(blocks[:len(blocks)-2], block{
+				lux:     append(a.lux, b.lux...),
+				sum:     a.sum + b.sum,
+				samples: a.samples + b.samples,
+			})
+		}
+	}
+	var fitted [][2]float64
+	for _, b := range blocks {
+		mean := b.sum / float64(b.samples)
+		for i, lux := range b.lux {
+			if i > 0 && lux == b.lux[i-1] {
+				continue
+			}
+			fitted = append(fitted, [2]float64{lux, mean})
+		}
+	}
+	return fitted
+}
+
+// Learn records the brightness chosen by the user in the current lux,
+// and refits the Curve from the Model. The next Update starts from the brightness.
+// The Model is created from the Curve if nil.
+func (a *AutoController) Learn(raw uint) error {
+	if !a.started {
+		return errors.New("can not learn before the lux is read")
+	}
+	if a.Model == nil {
+		a.Model = &LuxModel{Base: a.Curve}
+	}
+	a.Model.Add(a.lux, a.device.PercentOf(raw))
+	curve, err := a.Model.Fit()
+	if err != nil {
+		return err
+	}
+	a.Curve = curve
+	a.Reset()
+	if a.OnLearn != nil {
+		return a.OnLearn(a.Model)
+	}
+	return nil
+}
+
+func (p *Persister) modelFile(d *Device) (string, error) {
+	file, err := p.file(d)
+	if err != nil {
+		return "", err
+	}
+	return file + ".lux", nil
+}
+
+// SaveLuxModel saves the learned model of the device.
+func (p *Persister) SaveLuxModel(d *Device, m *LuxModel) error {
+	if err := os.MkdirAll(p.dir(), 0755); err != nil {
+		return err
+	}
+	b, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	file, err := p.modelFile(d)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(file, append(b, '\n'), 0644)
+}
+
+// LoadLuxModel loads the learned model of the device,
+// the error satisfies os.IsNotExist if the device has no saved model.
+func (p *Persister) LoadLuxModel(d *Device) (*LuxModel, error) {
+	file, err := p.modelFile(d)
+	if err != nil {
+		return nil, err
+	}
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	m := new(LuxModel)
+	if err := json.Unmarshal(b, m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
@@ -0,0 +1,100 @@
+// +build linux
+
+package brightness
+
+import (
+	"os"
+	"sync"
+	"syscall"
+
+	"github.com/godbus/dbus/v5"
+)
+
+// Logind writes the brightness through SetBrightness of systemd-logind,
+// it is permitted for the user of the active session without the write permission of sysfs.
+type Logind struct {
+	// Address of the bus, the system bus if empty.
+	Address string
+
+	// Session is the object path of the session, "/org/freedesktop/login1/session/auto" if empty.
+	Session dbus.ObjectPath
+
+	// If Always is true then always writes through logind,
+	// otherwise only if the direct write is denied.
+	Always bool
+
+	// kept open for the writes, e.g. the steps of the fade
+	mu   sync.Mutex
+	conn *dbus.Conn
+}
+
+const (
+	logindDest    = "org.freedesktop.login1"
+	logindSession = "/org/freedesktop/login1/session/auto"
+	logindMethod  = "org.freedesktop.login1.Session.SetBrightness"
+)
+
+// SetBrightness calls org.freedesktop.login1.Session.SetBrightness.
+// The connection is opened at the first call and reused,
+// and opened again if it is disconnected.
+func (l *Logind) SetBrightness(subsystem, name string, value uint32) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	session := l.Session
+	if session == "" {
+		session = logindSession
+	}
+	var err error
+	for retry := 0; retry < 2; retry++ {
+		if l.conn == nil {
+			if l.Address == "" {
+				l.conn, err = dbus.ConnectSystemBus()
+			} else {
+				l.conn, err = dbus.Connect(l.Address)
+			}
+			if err != nil {
+				l.conn = nil
+				return err
+			}
+		}
+		err = l.conn.Object(logindDest, session).Call(logindMethod, 0, subsystem, name, value).Err
+		if err == nil || l.conn.Connected() {
+			return err
+		}
+		// stale connection e.g. the bus is restarted
+		l.conn.Close()
+		l.conn = nil
+	}
+	return err
+}
+
+// Close closes the connection if opened.
+func (l *Logind) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.conn == nil {
+		return nil
+	}
+	err := l.conn.Close()
+	l.conn = nil
+	return err
+}
+
+// write through logind if the direct write is denied
+func (l *Logind) fallback(err error) bool {
+	if l == nil || err == nil {
+		return false
+	}
+	if pe, ok := err.(*os.PathError); ok {
+		err = pe.Err
+	}
+	return err == syscall.EACCES || err == syscall.EPERM || err == syscall.EROFS
+}
+
+// SysfsOption is the option of NewSysfs.
+type SysfsOption func(*sysfs)
+
+// WithLogind writes the brightness through logind.
+func WithLogind(l *Logind) SysfsOption {
+	return func(s *sysfs) { s.logind = l }
+}
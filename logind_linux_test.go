@@ -0,0 +1,232 @@
+// +build linux
+
+package brightness
+
+import (
+	"bufio"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+
+	"github.com/godbus/dbus/v5"
+)
+
+const testBusConfig = `<!DOCTYPE busconfig PUBLIC "-//freedesktop//DTD D-Bus Bus Configuration 1.0//EN"
+ "http://www.freedesktop.org/standards/dbus/1.0/busconfig.dtd">
+<busconfig>
+  <type>session</type>
+  <listen>unix:path=%s</listen>
+  <auth>EXTERNAL</auth>
+  <policy context="default">
+    <allow send_destination="*" eavesdrop="true"/>
+    <allow eavesdrop="true"/>
+    <allow own="*"/>
+  </policy>
+</busconfig>
+`
+
+// start the private bus, return the address
+func startBus(t *testing.T, dir string) (string, func()) {
+	t.Helper()
+	bin, err := exec.LookPath("dbus-daemon")
+	if err != nil {
+		t.Skip("dbus-daemon is not found")
+	}
+	config := filepath.Join(dir, "bus.conf")
+	err = ioutil.WriteFile(config, []byte(strings.Replace(testBusConfig, "%s", filepath.Join(dir, "bus"), 1)), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cmd := exec.Command(bin, "--config-file="+config, "--nofork", "--print-address")
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	address, err := bufio.NewReader(stdout).ReadString('\n')
+	if err != nil {
+		cmd.Process.Kill()
+		t.Fatal(err)
+	}
+	return strings.TrimSpace(address), func() {
+		cmd.Process.Kill()
+		cmd.Wait()
+	}
+}
+
+// stub of org.freedesktop.login1.Session
+type stubSession struct {
+	mu    sync.Mutex
+	calls []string
+	dir   string // write to dir/name/brightness
+}
+
+func (s *stubSession) SetBrightness(subsystem, name string, value uint32) *dbus.Error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.calls = append(s.calls, subsystem+":"+name)
+	err := writeUint(filepath.Join(s.dir, name, baseCurrent), uint(value))
+	if err != nil {
+		return dbus.MakeFailedError(err)
+	}
+	return nil
+}
+
+// unexported, not exported to the bus
+func (s *stubSession) history() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.calls...)
+}
+
+func (s *stubSession) reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.calls = nil
+}
+
+func TestLogind_Linux(t *testing.T) {
+	testRoot, err := ioutil.TempDir("", "TestLogind_Linux")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(testRoot)
+
+	address, stop := startBus(t, testRoot)
+	defer stop()
+
+	conn, err := dbus.Connect(address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	classRoot := filepath.Join(testRoot, "sys", "class", ClassBacklight)
+	if err := os.MkdirAll(classRoot, 0700); err != nil {
+		t.Fatal(err)
+	}
+	stub := &stubSession{dir: classRoot}
+	if err := conn.Export(stub, logindSession, "org.freedesktop.login1.Session"); err != nil {
+		t.Fatal(err)
+	}
+	reply, err := conn.RequestName(logindDest, dbus.NameFlagDoNotQueue)
+	if err != nil || reply != dbus.RequestNameReplyPrimaryOwner {
+		t.Fatalf("can not own the name %v %v", reply, err)
+	}
+
+	deviceRoot, err := makeDeviceDir(classRoot, "10", "100")
+	if err != nil {
+		t.Fatal(err)
+	}
+	name := filepath.Base(deviceRoot)
+	read := func() uint {
+		t.Helper()
+		ui, err := readUint(filepath.Join(deviceRoot, baseCurrent))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return ui
+	}
+
+	t.Run("Always", func(t *testing.T) {
+		cs, err := NewSysfs(filepath.Join(testRoot, "sys"), WithLogind(&Logind{Address: address, Always: true})).Discover()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := cs[0].Set(50); err != nil {
+			t.Fatal(err)
+		}
+		if out := read(); out != 50 {
+			t.Fatalf("want 50 but out %d", out)
+		}
+		if calls := stub.history(); len(calls) != 1 || calls[0] != ClassBacklight+":"+name {
+			t.Fatalf("unexpected calls %v", calls)
+		}
+	})
+
+	t.Run("Fallback", func(t *testing.T) {
+		stub.reset()
+		cs, err := NewSysfs(filepath.Join(testRoot, "sys"), WithLogind(&Logind{Address: address})).Discover()
+		if err != nil {
+			t.Fatal(err)
+		}
+		// permitted
+		if err := cs[0].Set(60); err != nil {
+			t.Fatal(err)
+		}
+		if calls := stub.history(); len(calls) != 0 {
+			t.Fatalf("unexpected calls %v", calls)
+		}
+
+		if os.Geteuid() == 0 {
+			t.Skip("root can write the read only file")
+		}
+		if err := os.Chmod(filepath.Join(deviceRoot, baseCurrent), 0400); err != nil {
+			t.Fatal(err)
+		}
+		defer os.Chmod(filepath.Join(deviceRoot, baseCurrent), 0600)
+		if err := cs[0].Set(70); err != nil {
+			t.Fatal(err)
+		}
+		if calls := stub.history(); len(calls) != 1 {
+			t.Fatalf("unexpected calls %v", calls)
+		}
+	})
+
+	t.Run("Reconnect", func(t *testing.T) {
+		l := &Logind{Address: address, Always: true}
+		defer l.Close()
+		if err := l.SetBrightness(ClassBacklight, name, 20); err != nil {
+			t.Fatal(err)
+		}
+		conn := l.conn
+		if err := l.SetBrightness(ClassBacklight, name, 21); err != nil {
+			t.Fatal(err)
+		}
+		if l.conn != conn {
+			t.Fatal("the connection is not reused")
+		}
+		// disconnected
+		conn.Close()
+		if err := l.SetBrightness(ClassBacklight, name, 22); err != nil {
+			t.Fatal(err)
+		}
+		if out := read(); out != 22 {
+			t.Fatalf("want 22 but out %d", out)
+		}
+	})
+
+	t.Run("Error", func(t *testing.T) {
+		l := &Logind{Address: address, Always: true, Session: "/org/freedesktop/login1/session/not_exist"}
+		if err := l.SetBrightness(ClassBacklight, name, 10); err == nil {
+			t.Fatal("expected error but nil")
+		}
+	})
+}
+
+func TestLogindFallback_Linux(t *testing.T) {
+	l := &Logind{}
+	for _, test := range []struct {
+		err error
+		exp bool
+	}{
+		{nil, false},
+		{&os.PathError{Op: "open", Path: "brightness", Err: syscall.EACCES}, true},
+		{&os.PathError{Op: "open", Path: "brightness", Err: syscall.EROFS}, true},
+		{&os.PathError{Op: "open", Path: "brightness", Err: syscall.ENOENT}, false},
+		{syscall.EPERM, true},
+	} {
+		if out := l.fallback(test.err); out != test.exp {
+			t.Fatalf("%v exp %v but out %v", test.err, test.exp, out)
+		}
+	}
+	if (*Logind)(nil).fallback(syscall.EACCES) {
+		t.Fatal("nil Logind is expected no fallback")
+	}
+}
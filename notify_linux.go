@@ -0,0 +1,70 @@
+// +build linux
+
+package brightness
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"syscall"
+	"unsafe"
+)
+
+// notify by inotify on brightness, actual_brightness and brightness_hw_changed,
+// the sysfs notifies the writes from the user space and sysfs_notify by the kernel
+func (d *device) Notify(ctx context.Context) (<-chan Source, error) {
+	fd, err := syscall.InotifyInit1(syscall.IN_NONBLOCK | syscall.IN_CLOEXEC)
+	if err != nil {
+		return nil, err
+	}
+	// non blocking file is closed while reading
+	f := os.NewFile(uintptr(fd), "inotify")
+	sources := make(map[int32]Source)
+	for _, w := range []struct {
+		base   string
+		source Source
+	}{
+		{baseCurrent, SourceSoftware},
+		{baseActual, SourceSoftware},
+		{baseHwChanged, SourceHardware},
+	} {
+		wd, err := syscall.InotifyAddWatch(fd, filepath.Join(d.root, w.base), syscall.IN_MODIFY|syscall.IN_CLOSE_WRITE)
+		if err == nil {
+			sources[int32(wd)] = w.source
+		}
+	}
+	if len(sources) == 0 {
+		f.Close()
+		return nil, ErrNotSupported
+	}
+
+	ch := make(chan Source, 1)
+	go func() {
+		<-ctx.Done()
+		f.Close()
+	}()
+	go func() {
+		defer close(ch)
+		buf := make([]byte, 4096)
+		for {
+			n, err := f.Read(buf)
+			if err != nil {
+				return
+			}
+			source := SourceSoftware
+			for off := 0; off+syscall.SizeofInotifyEvent <= n; {
+				ev := (*syscall.InotifyEvent)(unsafe.Pointer(&buf[off]))
+				if sources[ev.Wd] == SourceHardware {
+					source = SourceHardware
+				}
+				off += syscall.SizeofInotifyEvent + int(ev.Len)
+			}
+			select {
+			case ch <- source:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return ch, nil
+}
@@ -0,0 +1,86 @@
+package brightness
+
+import (
+	"errors"
+	"sort"
+)
+
+// Order is the order of devices returned by ReadDevice*.
+type Order int
+
+const (
+	// OrderPreferred sorts devices by the preference like systemd-backlight.
+	// native GPU backlights come first, then firmware, platform, raw,
+	// and other devices like LEDs, ties are sorted by name.
+	OrderPreferred Order = iota
+
+	// OrderName sorts devices by name.
+	OrderName
+)
+
+// DefaultOrder is used by ReadDeviceAll, ReadDeviceIndex and ReadDevicePat,
+// use ReadDeviceAllOrder and ReadDeviceIndexOrder for the other order.
+var DefaultOrder = OrderPreferred
+
+func (o Order) String() string {
+	switch o {
+	case OrderPreferred:
+		return "preferred"
+	case OrderName:
+		return "name"
+	default:
+		return "unknown"
+	}
+}
+
+// ParseOrder parses the string returned by Order.String.
+func ParseOrder(s string) (Order, error) {
+	for _, o := range []Order{OrderPreferred, OrderName} {
+		if o.String() == s {
+			return o, nil
+		}
+	}
+	return 0, errors.New("invalid order " + s)
+}
+
+// SortDevices sorts devices in place by the order.
+func SortDevices(devices []*Device, order Order) {
+	byName := func(i, j int) bool { return devices[i].Name() < devices[j].Name() }
+	if order != OrderPreferred {
+		sort.Slice(devices, byName)
+		return
+	}
+	ranks := make(map[*Device]int, len(devices))
+	for _, d := range devices {
+		ranks[d] = rank(d)
+	}
+	sort.Slice(devices, func(i, j int) bool {
+		if ri, rj := ranks[devices[i]], ranks[devices[j]]; ri != rj {
+			return ri < rj
+		}
+		return byName(i, j)
+	})
+}
+
+// lower is preferred
+func rank(d *Device) int {
+	m, err := d.Metadata()
+	if err != nil {
+		return 5
+	}
+	switch m.Type {
+	case "raw":
+		// raw backlight of the PCI device is expected the native GPU backlight,
+		// the others e.g. ddcci of the external monitors are not
+		if m.Subsystem == "pci" {
+			return 0
+		}
+		return 3
+	case "firmware":
+		return 1
+	case "platform":
+		return 2
+	default:
+		return 4
+	}
+}
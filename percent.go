@@ -0,0 +1,97 @@
+package brightness
+
+import (
+	"errors"
+	"math"
+	"strconv"
+)
+
+// Rounding is the rounding of the percentage to the raw brightness.
+type Rounding int
+
+const (
+	// RoundNearest rounds to the nearest raw brightness, half away from zero.
+	RoundNearest Rounding = iota
+
+	// RoundUp rounds to the smallest raw brightness that is not less than the percentage.
+	RoundUp
+
+	// RoundDown rounds to the largest raw brightness that is not greater than the percentage.
+	RoundDown
+)
+
+// tolerance of the float error, avoid to round up 50.000000001 to 51
+const roundTolerance = 1e-9
+
+func (r Rounding) round(f float64) uint {
+	var out float64
+	switch r {
+	case RoundUp:
+		out = math.Ceil(f - roundTolerance)
+	case RoundDown:
+		out = math.Floor(f + roundTolerance)
+	default:
+		out = math.Round(f)
+	}
+	if out < 0 {
+		return 0
+	}
+	return uint(out)
+}
+
+type percentConfig struct {
+	rounding Rounding
+	force    bool
+}
+
+// PercentOption is the option of SetPercent.
+type PercentOption func(*percentConfig)
+
+// WithRounding changes the rounding from RoundNearest.
+func WithRounding(r Rounding) PercentOption {
+	return func(c *percentConfig) { c.rounding = r }
+}
+
+// WithForce ignores the limit same as Set with force.
+func WithForce() PercentOption {
+	return func(c *percentConfig) { c.force = true }
+}
+
+// Percent returns the current perceived brightness in [0, 100] through the Curve.
+// The value is not rounded, so SetPercent(Percent()) always keeps the raw brightness.
+func (d *Device) Percent() (float64, error) {
+	current, err := d.internal.Current()
+	if err != nil {
+		return 0, err
+	}
+	return d.PercentOf(current), nil
+}
+
+// PercentOf returns the perceived brightness in [0, 100] of the raw brightness.
+func (d *Device) PercentOf(raw uint) float64 {
+	return d.toPerceived(raw) * 100
+}
+
+// RawOf returns the raw brightness of the perceived percentage in [0, 100].
+// The percentage is converted through the Curve and then rounded by the rounding,
+// the result is in [0, Max()].
+func (d *Device) RawOf(p float64, r Rounding) uint {
+	raw := r.round(d.Curve().ToRaw(p/100) * float64(d.max))
+	if raw > d.max {
+		return d.max
+	}
+	return raw
+}
+
+// SetPercent sets the perceived brightness in [0, 100], rounded by RoundNearest as default.
+// The raw brightness is limited as same as Set.
+func (d *Device) SetPercent(p float64, opts ...PercentOption) error {
+	var c percentConfig
+	for _, opt := range opts {
+		opt(&c)
+	}
+	if math.IsNaN(p) || p < 0 || p > 100 {
+		return errors.New("invalid percentage " + strconv.FormatFloat(p, 'g', -1, 64))
+	}
+	return d.Set(d.RawOf(p, c.rounding), c.force)
+}
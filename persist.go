@@ -0,0 +1,123 @@
+package brightness
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+)
+
+// DefaultStateDir is the default directory of Persister.
+const DefaultStateDir = "/var/lib/akari"
+
+// Persister saves and loads the brightness per device across boots like systemd-backlight.
+// The state is keyed by the path of the device, so it is stable even if the index is changed.
+type Persister struct {
+	// Dir is the state directory, DefaultStateDir if empty.
+	Dir string
+}
+
+func (p *Persister) dir() string {
+	if p.Dir == "" {
+		return DefaultStateDir
+	}
+	return p.Dir
+}
+
+// file name of the device, escaped path or backend:class:name if the path is unknown
+func (p *Persister) file(d *Device) (string, error) {
+	meta, err := d.Metadata()
+	if err != nil {
+		return "", err
+	}
+	key := meta.Path
+	if key == "" {
+		key = d.Backend() + ":" + d.Class() + ":" + d.Name()
+	}
+	return filepath.Join(p.dir(), url.PathEscape(key)), nil
+}
+
+// Save saves the current brightness of the devices, or ReadDeviceAll if devices are not provided.
+func (p *Persister) Save(devices ...*Device) error {
+	if len(devices) == 0 {
+		var err error
+		devices, err = ReadDeviceAll()
+		if err != nil {
+			return err
+		}
+	}
+	if err := os.MkdirAll(p.dir(), 0755); err != nil {
+		return err
+	}
+	for _, d := range devices {
+		state, err := d.State()
+		if err != nil {
+			return err
+		}
+		b, err := json.Marshal(state)
+		if err != nil {
+			return err
+		}
+		file, err := p.file(d)
+		if err != nil {
+			return err
+		}
+		if err := ioutil.WriteFile(file, append(b, '\n'), 0644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Load loads the saved brightness to the devices, or ReadDeviceAll if devices are not provided.
+// The brightness is rescaled if the max brightness is changed. The backlights are
+// clamped to the limits of the Policy, so a saved 0 never boots to a black screen,
+// and the LEDs are restored as saved like systemd-backlight, e.g. the keyboard backlight turned off.
+// The devices that have no saved state are kept as is.
+func (p *Persister) Load(devices ...*Device) error {
+	if len(devices) == 0 {
+		var err error
+		devices, err = ReadDeviceAll()
+		if err != nil {
+			return err
+		}
+	}
+	for _, d := range devices {
+		file, err := p.file(d)
+		if err != nil {
+			return err
+		}
+		b, err := ioutil.ReadFile(file)
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return err
+		}
+		var state DeviceState
+		if err := json.Unmarshal(b, &state); err != nil {
+			return err
+		}
+		want := state.value(d)
+		if d.Class() == ClassLEDs {
+			if want > d.max {
+				want = d.max
+			}
+			if err := d.write(want); err != nil {
+				return err
+			}
+			continue
+		}
+		if min := d.Min(); want < min {
+			want = min
+		}
+		if cap := d.Cap(); want > cap {
+			want = cap
+		}
+		if err := d.Set(want, false); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,77 @@
+package brightness
+
+import "math"
+
+// Policy limits the brightness that Device sets by Set without force,
+// SetPercent, Step, FadeTo and Set{Max,Mid,Min}.
+type Policy struct {
+	// The lower limit is the larger one of MinRaw and MinPercent of the max brightness.
+	// The lower limit is at least 1 unless AllowZero.
+	MinRaw     uint
+	MinPercent float64
+
+	// AllowZero permits to set 0 explicitly regardless of the lower limit.
+	// Step is still stopped at the lower limit.
+	AllowZero bool
+
+	// The upper limit is the smaller one of MaxRaw and MaxPercent of the max brightness.
+	// 0 means no limit.
+	MaxRaw     uint
+	MaxPercent float64
+}
+
+// DefaultPolicy is the policy of the devices unless SetPolicy,
+// the lower limit is 10 percent of the max brightness or 1.
+func DefaultPolicy() Policy {
+	return Policy{MinRaw: 1, MinPercent: 10}
+}
+
+// NoPolicy permits the all brightness from 0 to the max brightness.
+func NoPolicy() Policy {
+	return Policy{AllowZero: true}
+}
+
+// SetPolicy sets the policy of the device.
+func (d *Device) SetPolicy(p Policy) { d.policy = &p }
+
+// Policy returns the policy of the device.
+func (d *Device) Policy() Policy {
+	if d.policy == nil {
+		return DefaultPolicy()
+	}
+	return *d.policy
+}
+
+// Min returns the lower limit of the Policy, in [0, Max()].
+func (d *Device) Min() uint {
+	p := d.Policy()
+	min := p.MinRaw
+	if percent := uint(math.Floor(float64(d.max) * p.MinPercent / 100)); percent > min {
+		min = percent
+	}
+	if min == 0 && !p.AllowZero {
+		min = 1
+	}
+	if min > d.max {
+		return d.max
+	}
+	return min
+}
+
+// Cap returns the upper limit of the Policy, in [Min(), Max()].
+func (d *Device) Cap() uint {
+	p := d.Policy()
+	cap := d.max
+	if p.MaxRaw != 0 && p.MaxRaw < cap {
+		cap = p.MaxRaw
+	}
+	if p.MaxPercent > 0 {
+		if percent := uint(math.Floor(float64(d.max) * p.MaxPercent / 100)); percent < cap {
+			cap = percent
+		}
+	}
+	if min := d.Min(); cap < min {
+		return min
+	}
+	return cap
+}
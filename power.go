@@ -0,0 +1,30 @@
+package brightness
+
+// Controller may implement PowerController to blank the panel
+// without changing the brightness.
+type PowerController interface {
+	Powered() (bool, error)
+	SetPower(on bool) error
+}
+
+// Powered reports whether the panel is powered.
+// return ErrNotSupported if the backend does not support power control.
+func (d *Device) Powered() (bool, error) {
+	if p, ok := d.internal.(PowerController); ok {
+		return p.Powered()
+	}
+	return false, ErrNotSupported
+}
+
+// PowerOn unblanks the panel.
+func (d *Device) PowerOn() error { return d.setPower(true) }
+
+// PowerOff blanks the panel, the brightness is not changed.
+func (d *Device) PowerOff() error { return d.setPower(false) }
+
+func (d *Device) setPower(on bool) error {
+	if p, ok := d.internal.(PowerController); ok {
+		return p.SetPower(on)
+	}
+	return ErrNotSupported
+}
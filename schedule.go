@@ -0,0 +1,244 @@
+package brightness
+
+import (
+	"context"
+	"errors"
+	"math"
+	"strings"
+	"time"
+)
+
+// Clock is the source of the time, replaceable for test.
+type Clock interface {
+	Now() time.Time
+	After(d time.Duration) <-chan time.Time
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time                         { return time.Now() }
+func (systemClock) After(d time.Duration) <-chan time.Time { return time.After(d) }
+
+// SystemClock is the Clock of the system.
+var SystemClock Clock = systemClock{}
+
+// Window is the period of the transition between the events of the sun,
+// e.g. from Dawn to Sunrise plus 30 minutes.
+type Window struct {
+	From       SunEvent
+	FromOffset time.Duration
+	To         SunEvent
+	ToOffset   time.Duration
+}
+
+// ParseWindow parses "EVENT[+-OFFSET]..EVENT[+-OFFSET]" e.g. "dawn..sunrise+30m".
+func ParseWindow(s string) (Window, error) {
+	fields := strings.Split(s, "..")
+	if len(fields) != 2 {
+		return Window{}, errors.New("invalid window " + s)
+	}
+	from, fromOffset, err := parseSunEventOffset(fields[0])
+	if err != nil {
+		return Window{}, err
+	}
+	to, toOffset, err := parseSunEventOffset(fields[1])
+	if err != nil {
+		return Window{}, err
+	}
+	return Window{From: from, FromOffset: fromOffset, To: to, ToOffset: toOffset}, nil
+}
+
+func parseSunEventOffset(s string) (SunEvent, time.Duration, error) {
+	i := strings.IndexAny(s, "+-")
+	if i < 0 {
+		e, err := ParseSunEvent(s)
+		return e, 0, err
+	}
+	e, err := ParseSunEvent(s[:i])
+	if err != nil {
+		return 0, 0, err
+	}
+	offset, err := time.ParseDuration(s[i:])
+	if err != nil {
+		return 0, 0, err
+	}
+	return e, offset, nil
+}
+
+func (w Window) String() string {
+	format := func(e SunEvent, offset time.Duration) string {
+		switch {
+		case offset > 0:
+			return e.String() + "+" + offset.String()
+		case offset < 0:
+			return e.String() + offset.String()
+		}
+		return e.String()
+	}
+	return format(w.From, w.FromOffset) + ".." + format(w.To, w.ToOffset)
+}
+
+// times of the window in the day, the missing events are replaced by
+// the nearest ones toward the noon, e.g. Sunrise for Dawn in the white nights
+func (w Window) times(s SunTimes) (from, to time.Time) {
+	at := func(e SunEvent) time.Time {
+		for {
+			if t := s.Time(e); !t.IsZero() || e == Noon {
+				return t
+			}
+			if e < Noon {
+				e++
+			} else {
+				e--
+			}
+		}
+	}
+	from = at(w.From).Add(w.FromOffset)
+	to = at(w.To).Add(w.ToOffset)
+	if to.Before(from) {
+		to = from
+	}
+	return from, to
+}
+
+// Schedule changes the brightness between Day and Night by the sun at the location.
+// Modify the fields before Percent, Update or Run.
+type Schedule struct {
+	// in degrees, north and east are positive
+	Latitude, Longitude float64
+
+	// Day and Night are the brightness in percent.
+	Day, Night float64
+
+	// Morning is the transition from Night to Day, Evening is from Day to Night.
+	Morning, Evening Window
+
+	// Interval is the interval of Update by Run.
+	Interval time.Duration
+
+	// Fade is the duration of each change by Update.
+	Fade   time.Duration
+	Easing Easing
+
+	// Clock drives Run and the fades of Update, SystemClock if nil.
+	Clock Clock
+}
+
+// NewSchedule returns the Schedule with the default settings,
+// the transitions are in the civil twilights.
+func NewSchedule(latitude, longitude float64) (*Schedule, error) {
+	if _, err := Sun(time.Now(), latitude, longitude); err != nil {
+		return nil, err
+	}
+	return &Schedule{
+		Latitude:  latitude,
+		Longitude: longitude,
+		Day:       100,
+		Night:     30,
+		Morning:   Window{From: Dawn, To: Sunrise},
+		Evening:   Window{From: Sunset, To: Dusk},
+		Interval:  time.Minute,
+		Fade:      time.Second,
+		Easing:    EaseInOut,
+		Clock:     SystemClock,
+	}, nil
+}
+
+func (s *Schedule) clock() Clock {
+	if s.Clock == nil {
+		return SystemClock
+	}
+	return s.Clock
+}
+
+// Percent returns the brightness in percent at t.
+// The solar day nearest to t is used, so the location of t does not matter.
+func (s *Schedule) Percent(t time.Time) (float64, error) {
+	sun, err := Sun(t, s.Latitude, s.Longitude)
+	if err != nil {
+		return 0, err
+	}
+	switch {
+	case t.Sub(sun.Noon) > 12*time.Hour:
+		sun, err = Sun(t.AddDate(0, 0, 1), s.Latitude, s.Longitude)
+	case sun.Noon.Sub(t) > 12*time.Hour:
+		sun, err = Sun(t.AddDate(0, 0, -1), s.Latitude, s.Longitude)
+	}
+	if err != nil {
+		return 0, err
+	}
+	switch {
+	case sun.PolarDay:
+		return s.Day, nil
+	case sun.PolarNight:
+		return s.Night, nil
+	}
+	m0, m1 := s.Morning.times(sun)
+	e0, e1 := s.Evening.times(sun)
+	progress := func(from, to time.Time) float64 {
+		if !to.After(from) {
+			return 1
+		}
+		return float64(t.Sub(from)) / float64(to.Sub(from))
+	}
+	switch {
+	case t.Before(m0) || !t.Before(e1):
+		return s.Night, nil
+	case t.Before(m1):
+		return s.Night + (s.Day-s.Night)*progress(m0, m1), nil
+	case t.Before(e0):
+		return s.Day, nil
+	default:
+		return s.Day + (s.Night-s.Day)*progress(e0, e1), nil
+	}
+}
+
+// Update fades the devices to the brightness of now by the Clock.
+func (s *Schedule) Update(ctx context.Context, devices ...*Device) error {
+	clock := s.clock()
+	p, err := s.Percent(clock.Now())
+	if err != nil {
+		return err
+	}
+	for _, d := range devices {
+		target := d.RawOf(math.Max(0, math.Min(100, p)), RoundNearest)
+		if min := d.Min(); target < min {
+			target = min
+		}
+		if cap := d.Cap(); target > cap {
+			target = cap
+		}
+		current, err := d.Current()
+		if err != nil {
+			return err
+		}
+		if target == current {
+			continue
+		}
+		if err := d.check(target, false); err != nil {
+			return err
+		}
+		if err := d.fadeClock(ctx, clock, target, s.Fade, s.Easing); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Run updates the devices at every Interval until ctx is done,
+// and returns ctx.Err() or the error of Update.
+func (s *Schedule) Run(ctx context.Context, devices ...*Device) error {
+	if s.Interval <= 0 {
+		return errors.New("interval must be positive")
+	}
+	for {
+		if err := s.Update(ctx, devices...); err != nil {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-s.clock().After(s.Interval):
+		}
+	}
+}
@@ -0,0 +1,201 @@
+package brightness
+
+import (
+	"encoding/csv"
+	"errors"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// in-memory Controller
+type memory struct {
+	name         string
+	current, max uint
+}
+
+func (m *memory) Name() string           { return m.name }
+func (m *memory) Current() (uint, error) { return m.current, nil }
+func (m *memory) Max() (uint, error)     { return m.max, nil }
+func (m *memory) Set(ui uint) error {
+	if ui > m.max {
+		return errors.New("requested brightness over the max")
+	}
+	m.current = ui
+	return nil
+}
+
+// NewMemoryDevice returns the Device that only holds the brightness in memory,
+// e.g. for Simulate. The curve is LinearCurve.
+func NewMemoryDevice(name string, current, max uint) (*Device, error) {
+	if max == 0 {
+		return nil, errors.New(name + " max brightness is 0")
+	}
+	if current > max {
+		return nil, errors.New("requested brightness over the max")
+	}
+	return &Device{
+		internal: &memory{name: name, current: current, max: max},
+		backend:  "memory",
+		curve:    LinearCurve,
+		max:      max,
+	}, nil
+}
+
+// LuxSample is the lux read at the time from the start of the trace.
+type LuxSample struct {
+	Time time.Duration
+	Lux  float64
+}
+
+// ReadLuxTrace reads the CSV of "TIME,LUX" lines.
+// TIME is the seconds or RFC 3339 timestamp, and must not decrease.
+// The header line is skipped. The times are relative to the first sample.
+func ReadLuxTrace(r io.Reader) ([]LuxSample, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	cr.TrimLeadingSpace = true
+	cr.Comment = '#'
+	var trace []LuxSample
+	var start time.Time
+	for line := 1; ; line++ {
+		record, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if len(record) < 2 {
+			return nil, errors.New("lux trace requires TIME,LUX at line " + strconv.Itoa(line))
+		}
+		lux, err := strconv.ParseFloat(strings.TrimSpace(record[1]), 64)
+		if err != nil {
+			if line == 1 {
+				continue
+			}
+			return nil, errors.New("invalid lux at line " + strconv.Itoa(line))
+		}
+		var at time.Time
+		if sec, err := strconv.ParseFloat(strings.TrimSpace(record[0]), 64); err == nil {
+			at = time.Unix(0, 0).Add(time.Duration(sec * float64(time.Second)))
+		} else if at, err = time.Parse(time.RFC3339Nano, strings.TrimSpace(record[0])); err != nil {
+			return nil, errors.New("invalid time at line " + strconv.Itoa(line))
+		}
+		if len(trace) == 0 {
+			start = at
+		}
+		s := LuxSample{Time: at.Sub(start), Lux: lux}
+		if len(trace) > 0 && s.Time < trace[len(trace)-1].Time {
+			return nil, errors.New("time decreased at line " + strconv.Itoa(line))
+		}
+		trace = append(trace, s)
+	}
+	if len(trace) == 0 {
+		return nil, errors.New("lux trace is empty")
+	}
+	return trace, nil
+}
+
+// SimulationStep is the state at an Update of the simulation.
+type SimulationStep struct {
+	Time       time.Duration
+	Lux        float64
+	Brightness uint
+	Percent    float64
+}
+
+// SimulationResult is the brightness timeline and the metrics of Simulate.
+type SimulationResult struct {
+	Timeline []SimulationStep
+
+	// number of the changes of the brightness,
+	// the intermediate writes of the fade are not counted
+	Writes int
+
+	// the largest change of the brightness at an Update in percent
+	MaxJump float64
+
+	// duration from the last change of lux to the last write,
+	// 0 if nothing is written after that
+	Settle time.Duration
+}
+
+// sample-and-hold the trace
+type traceSource struct {
+	trace []LuxSample
+	now   time.Duration
+}
+
+func (s *traceSource) Lux() (float64, error) {
+	lux := s.trace[0].Lux
+	for _, sample := range s.trace {
+		if sample.Time > s.now {
+			break
+		}
+		lux = sample.Lux
+	}
+	return lux, nil
+}
+
+// Simulate replays the trace through the AutoController in the virtual time
+// without waiting, Update at every Interval and write the brightness to the Device
+// instantly, so the Device should be NewMemoryDevice. The LuxSource is not used.
+func (a *AutoController) Simulate(trace []LuxSample) (*SimulationResult, error) {
+	if len(trace) == 0 {
+		return nil, errors.New("lux trace is empty")
+	}
+	if a.Interval <= 0 {
+		return nil, errors.New("interval must be positive")
+	}
+	src := &traceSource{trace: trace}
+	orig := a.source
+	a.source = src
+	defer func() { a.source = orig }()
+	a.Reset()
+
+	var lastChange time.Duration
+	for i := 1; i < len(trace); i++ {
+		if trace[i].Lux != trace[i-1].Lux {
+			lastChange = trace[i].Time
+		}
+	}
+
+	result := new(SimulationResult)
+	var lastWrite time.Duration
+	start := time.Unix(0, 0)
+	end := trace[len(trace)-1].Time
+	for t := time.Duration(0); t <= end; t += a.Interval {
+		src.now = t
+		target, err := a.Update(start.Add(t))
+		if err != nil {
+			return nil, err
+		}
+		current, err := a.device.Current()
+		if err != nil {
+			return nil, err
+		}
+		if target != current {
+			if err := a.device.write(target); err != nil {
+				return nil, err
+			}
+			result.Writes++
+			lastWrite = t
+			jump := math.Abs(a.device.PercentOf(target) - a.device.PercentOf(current))
+			result.MaxJump = math.Max(result.MaxJump, jump)
+		}
+		lux, _ := src.Lux()
+		result.Timeline = append(result.Timeline, SimulationStep{
+			Time:       t,
+			Lux:        lux,
+			Brightness: target,
+			Percent:    a.device.PercentOf(target),
+		})
+	}
+	if result.Writes > 0 && lastWrite >= lastChange {
+		result.Settle = lastWrite - lastChange
+	}
+	return result, nil
+}
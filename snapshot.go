@@ -0,0 +1,135 @@
+package brightness
+
+import (
+	"encoding/json"
+	"io"
+	"math"
+)
+
+// DeviceState is the state of a device in Snapshot.
+type DeviceState struct {
+	Name    string `json:"name"`
+	Backend string `json:"backend,omitempty"`
+	Class   string `json:"class,omitempty"`
+	Path    string `json:"path,omitempty"`
+	Current uint   `json:"current"`
+	Max     uint   `json:"max"`
+}
+
+// Snapshot is the brightness of devices at a time.
+type Snapshot struct {
+	Devices []DeviceState `json:"devices"`
+}
+
+// TakeSnapshot takes the Snapshot of the devices, or ReadDeviceAll if devices are not provided.
+func TakeSnapshot(devices ...*Device) (*Snapshot, error) {
+	if len(devices) == 0 {
+		var err error
+		devices, err = ReadDeviceAll()
+		if err != nil {
+			return nil, err
+		}
+	}
+	s := &Snapshot{Devices: make([]DeviceState, 0, len(devices))}
+	for _, d := range devices {
+		state, err := d.State()
+		if err != nil {
+			return nil, err
+		}
+		s.Devices = append(s.Devices, state)
+	}
+	return s, nil
+}
+
+// State returns the current DeviceState of the device.
+func (d *Device) State() (DeviceState, error) {
+	current, err := d.internal.Current()
+	if err != nil {
+		return DeviceState{}, err
+	}
+	meta, err := d.Metadata()
+	if err != nil {
+		return DeviceState{}, err
+	}
+	return DeviceState{
+		Name:    d.Name(),
+		Backend: d.Backend(),
+		Class:   d.Class(),
+		Path:    meta.Path,
+		Current: current,
+		Max:     d.max,
+	}, nil
+}
+
+// Matches reports whether the state is taken from the device.
+// The devices are matched by the path if both are known, otherwise by the backend, class and name.
+func (s DeviceState) Matches(d *Device) bool {
+	if s.Path != "" {
+		if meta, err := d.Metadata(); err == nil && meta.Path != "" {
+			return s.Path == meta.Path
+		}
+	}
+	return s.Backend == d.Backend() && s.Class == d.Class() && s.Name == d.Name()
+}
+
+// Restore sets the brightness of the state to the device ignoring the Policy.
+// The brightness is rescaled if the max brightness is changed.
+func (s DeviceState) Restore(d *Device) error {
+	return d.Set(s.value(d), true)
+}
+
+// brightness of the state rescaled to the max of the device
+func (s DeviceState) value(d *Device) uint {
+	want := s.Current
+	if s.Max != 0 && s.Max != d.max {
+		want = uint(math.Round(float64(s.Current) * float64(d.max) / float64(s.Max)))
+	}
+	if want > d.max {
+		want = d.max
+	}
+	return want
+}
+
+// Restore restores the snapshot to the matched devices,
+// or ReadDeviceAll if devices are not provided.
+// The states that are not matched any devices are ignored.
+func (s *Snapshot) Restore(devices ...*Device) error {
+	if len(devices) == 0 {
+		var err error
+		devices, err = ReadDeviceAll()
+		if err != nil {
+			return err
+		}
+	}
+	for _, state := range s.Devices {
+		for _, d := range devices {
+			if !state.Matches(d) {
+				continue
+			}
+			if err := state.Restore(d); err != nil {
+				return err
+			}
+			break
+		}
+	}
+	return nil
+}
+
+// WriteTo writes the snapshot as JSON.
+func (s *Snapshot) WriteTo(w io.Writer) (int64, error) {
+	b, err := json.MarshalIndent(s, "", "\t")
+	if err != nil {
+		return 0, err
+	}
+	n, err := w.Write(append(b, '\n'))
+	return int64(n), err
+}
+
+// ReadSnapshot reads the snapshot written by WriteTo.
+func ReadSnapshot(r io.Reader) (*Snapshot, error) {
+	s := new(Snapshot)
+	if err := json.NewDecoder(r).Decode(s); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
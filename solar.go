@@ -0,0 +1,145 @@
+package brightness
+
+import (
+	"errors"
+	"math"
+	"time"
+)
+
+// SunEvent is the event of the sun in a day.
+type SunEvent int
+
+const (
+	// the sun is 6 degrees below the horizon in the morning, start of the civil twilight
+	Dawn SunEvent = iota
+	Sunrise
+	Noon
+	Sunset
+	// the sun is 6 degrees below the horizon in the evening, end of the civil twilight
+	Dusk
+)
+
+var sunEventNames = []string{"dawn", "sunrise", "noon", "sunset", "dusk"}
+
+func (e SunEvent) String() string {
+	if e < 0 || int(e) >= len(sunEventNames) {
+		return "unknown"
+	}
+	return sunEventNames[e]
+}
+
+// ParseSunEvent parses "dawn", "sunrise", "noon", "sunset" or "dusk".
+func ParseSunEvent(s string) (SunEvent, error) {
+	for i, name := range sunEventNames {
+		if s == name {
+			return SunEvent(i), nil
+		}
+	}
+	return 0, errors.New("invalid sun event " + s)
+}
+
+// SunTimes is the times of the sun in a day.
+// The events that do not occur in the day are zero.
+type SunTimes struct {
+	Dawn, Sunrise, Noon, Sunset, Dusk time.Time
+
+	// the sun does not set, or does not rise
+	PolarDay, PolarNight bool
+}
+
+// Time returns the time of the event, zero if it does not occur.
+func (s SunTimes) Time(e SunEvent) time.Time {
+	switch e {
+	case Dawn:
+		return s.Dawn
+	case Sunrise:
+		return s.Sunrise
+	case Noon:
+		return s.Noon
+	case Sunset:
+		return s.Sunset
+	case Dusk:
+		return s.Dusk
+	}
+	return time.Time{}
+}
+
+// altitudes of the sun
+const (
+	// refraction and the radius of the sun
+	altitudeSunrise = -0.833
+	altitudeCivil   = -6.0
+)
+
+// unix time of the Julian date 0
+const julianUnixEpoch = 2440587.5
+
+// J2000.0
+const julian2000 = 2451545.0
+
+func toJulian(t time.Time) float64 {
+	return float64(t.Unix())/86400 + julianUnixEpoch
+}
+
+func fromJulian(j float64, loc *time.Location) time.Time {
+	sec := (j - julianUnixEpoch) * 86400
+	return time.Unix(0, int64(math.Round(sec))*int64(time.Second)).In(loc)
+}
+
+func sind(deg float64) float64 { return math.Sin(deg * math.Pi / 180) }
+func cosd(deg float64) float64 { return math.Cos(deg * math.Pi / 180) }
+
+// Sun computes the times of the sun at the latitude and the longitude in degrees,
+// north and east are positive, in the local day of date. It works offline by the
+// sunrise equation, and the error is a few minutes in the middle latitudes.
+// The times are in the location of date.
+func Sun(date time.Time, latitude, longitude float64) (SunTimes, error) {
+	if math.IsNaN(latitude) || latitude < -90 || latitude > 90 {
+		return SunTimes{}, errors.New("latitude must be in [-90, 90]")
+	}
+	if math.IsNaN(longitude) || longitude < -180 || longitude > 180 {
+		return SunTimes{}, errors.New("longitude must be in [-180, 180]")
+	}
+	loc := date.Location()
+	y, m, d := date.Date()
+	// days from J2000.0 to the noon of the day
+	n := math.Round(toJulian(time.Date(y, m, d, 12, 0, 0, 0, time.UTC)) - julian2000)
+
+	// mean solar noon
+	j := n - longitude/360
+	// solar mean anomaly
+	anomaly := math.Mod(357.5291+0.98560028*j, 360)
+	// equation of the center
+	center := 1.9148*sind(anomaly) + 0.0200*sind(2*anomaly) + 0.0003*sind(3*anomaly)
+	// ecliptic longitude
+	ecliptic := math.Mod(anomaly+center+180+102.9372, 360)
+	transit := julian2000 + j + 0.0053*sind(anomaly) - 0.0069*sind(2*ecliptic)
+	// declination of the sun
+	sinDecl := sind(ecliptic) * sind(23.4397)
+	cosDecl := math.Sqrt(1 - sinDecl*sinDecl)
+
+	// half of the day above the altitude in degrees, NaN if the sun does not cross it
+	hourAngle := func(altitude float64) (float64, int) {
+		c := (sind(altitude) - sind(latitude)*sinDecl) / (cosd(latitude) * cosDecl)
+		switch {
+		case c > 1:
+			return math.NaN(), -1 // always below
+		case c < -1:
+			return math.NaN(), 1 // always above
+		}
+		return math.Acos(c) * 180 / math.Pi, 0
+	}
+
+	s := SunTimes{Noon: fromJulian(transit, loc)}
+	if w, above := hourAngle(altitudeSunrise); above == 0 {
+		s.Sunrise = fromJulian(transit-w/360, loc)
+		s.Sunset = fromJulian(transit+w/360, loc)
+	} else {
+		s.PolarDay, s.PolarNight = above > 0, above < 0
+	}
+	if w, above := hourAngle(altitudeCivil); above == 0 {
+		s.Dawn = fromJulian(transit-w/360, loc)
+		s.Dusk = fromJulian(transit+w/360, loc)
+	}
+	return s, nil
+}
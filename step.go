@@ -0,0 +1,134 @@
+package brightness
+
+import (
+	"errors"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Delta is the signed relative change of the brightness for Step.
+type Delta struct {
+	// percentage of perceived brightness, or raw brightness if Raw is true
+	Value float64
+	Raw   bool
+}
+
+// PercentDelta returns the Delta of the perceived percentage.
+func PercentDelta(p float64) Delta { return Delta{Value: p} }
+
+// RawDelta returns the Delta of the raw brightness.
+func RawDelta(n int) Delta { return Delta{Value: float64(n), Raw: true} }
+
+// ParseDelta parses the signed delta, "5" and "5%" are percentage, "raw:5" is raw brightness.
+func ParseDelta(s string) (Delta, error) {
+	if strings.HasPrefix(s, "raw:") {
+		n, err := strconv.Atoi(strings.TrimPrefix(s, "raw:"))
+		if err != nil {
+			return Delta{}, errors.New("invalid delta " + s)
+		}
+		return RawDelta(n), nil
+	}
+	p, err := strconv.ParseFloat(strings.TrimSuffix(s, "%"), 64)
+	if err != nil || math.IsNaN(p) || math.IsInf(p, 0) {
+		return Delta{}, errors.New("invalid delta " + s)
+	}
+	return PercentDelta(p), nil
+}
+
+func (d Delta) String() string {
+	if d.Raw {
+		return "raw:" + strconv.FormatFloat(d.Value, 'f', -1, 64)
+	}
+	return strconv.FormatFloat(d.Value, 'f', -1, 64) + "%"
+}
+
+// Step changes the brightness by the delta.
+// The change is at least 1 if the delta is not zero,
+// incrementing is stopped at Cap() and decrementing is stopped at Min() of the Policy.
+// Already under the Min() or over the Cap() is kept as is,
+// the step never changes against the direction of the delta.
+func (d *Device) Step(delta Delta) error {
+	current, err := d.internal.Current()
+	if err != nil {
+		return err
+	}
+	want := d.step(current, delta)
+	if want == current {
+		return nil
+	}
+	return d.write(want)
+}
+
+// StepValue returns the brightness that Step will set.
+func (d *Device) StepValue(delta Delta) (uint, error) {
+	current, err := d.internal.Current()
+	if err != nil {
+		return 0, err
+	}
+	return d.step(current, delta), nil
+}
+
+func (d *Device) step(current uint, delta Delta) uint {
+	switch {
+	case delta.Value > 0:
+		// over the max brightness is invalid, not over the Cap() by others
+		cap := d.Cap()
+		if current >= cap && current <= d.max {
+			return current
+		}
+		want := d.stepTarget(current, delta)
+		if want <= current {
+			want = current + 1
+		}
+		if want > cap {
+			want = cap
+		}
+		return want
+	case delta.Value < 0:
+		min := d.Min()
+		if current <= min {
+			return current
+		}
+		want := d.stepTarget(current, delta)
+		if want >= current {
+			want = current - 1
+		}
+		if want < min {
+			want = min
+		}
+		return want
+	default:
+		return current
+	}
+}
+
+// the result may be not changed from current
+func (d *Device) stepTarget(current uint, delta Delta) uint {
+	var change float64
+	switch {
+	case delta.Raw:
+		change = math.Abs(delta.Value)
+	case d.max >= 10 && d.perceptual():
+		target := d.toRaw(d.toPerceived(current) + delta.Value/100)
+		if delta.Value < 0 && target > current {
+			return current
+		}
+		return target
+	default:
+		change = math.Floor(float64(d.max) * math.Abs(delta.Value) / 100)
+	}
+	if delta.Value > 0 {
+		return current + uint(change)
+	}
+	if change >= float64(current) {
+		return 0
+	}
+	return current - uint(change)
+}
+
+// steps are linear in raw if false
+func (d *Device) perceptual() bool {
+	_, linear := d.Curve().(linearCurve)
+	return !linear
+}
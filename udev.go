@@ -0,0 +1,55 @@
+package brightness
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// UdevRulesFile is the suggested file name of UdevRules.
+const UdevRulesFile = "90-akari-brightness.rules"
+
+var validGroup = regexp.MustCompile(`^[a-z_][a-z0-9_-]*\$?$`)
+
+// UdevRules generates the udev rules that permit the group to write the brightness of the devices.
+// The devices that are not backlight or LEDs class are ignored.
+func UdevRules(devices []*Device, group string) (string, error) {
+	if !validGroup.MatchString(group) {
+		return "", errors.New("invalid group name " + group)
+	}
+	type key struct{ class, name string }
+	var keys []key
+	seen := make(map[key]bool)
+	for _, d := range devices {
+		k := key{d.Class(), d.Name()}
+		if k.class != ClassBacklight && k.class != ClassLEDs || seen[k] {
+			continue
+		}
+		if strings.ContainsAny(k.name, "\"\n") {
+			return "", errors.New("invalid device name " + k.name)
+		}
+		seen[k] = true
+		keys = append(keys, k)
+	}
+	if len(keys) == 0 {
+		return "", errors.New("no backlight or LEDs devices")
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].class != keys[j].class {
+			return keys[i].class < keys[j].class
+		}
+		return keys[i].name < keys[j].name
+	})
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "# generated by akari setup-udev\n")
+	fmt.Fprintf(&b, "# permit the group %s to write the brightness\n", group)
+	for _, k := range keys {
+		file := "/sys/class/" + k.class + "/%k/brightness"
+		fmt.Fprintf(&b, "ACTION==\"add\", SUBSYSTEM==\"%s\", KERNEL==\"%s\", RUN+=\"/bin/chgrp %s %s\", RUN+=\"/bin/chmod g+w %s\"\n",
+			k.class, k.name, group, file, file)
+	}
+	return b.String(), nil
+}
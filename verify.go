@@ -0,0 +1,73 @@
+package brightness
+
+import (
+	"fmt"
+	"time"
+)
+
+// VerifyError is returned when the hardware did not take the requested brightness.
+type VerifyError struct {
+	Name   string
+	Want   uint
+	Actual uint
+}
+
+func (e *VerifyError) Error() string {
+	return fmt.Sprintf("%s: requested brightness %d but actual %d", e.Name, e.Want, e.Actual)
+}
+
+// Actual returns the brightness that the hardware actually applied.
+// return ErrNotSupported if the backend does not report it.
+func (d *Device) Actual() (uint, error) {
+	if a, ok := d.internal.(ActualReader); ok {
+		return a.Actual()
+	}
+	return 0, ErrNotSupported
+}
+
+// EnableVerify enables to read back the brightness after each write.
+// If the actual brightness is not the requested one then the write is
+// retried the retries times with waiting the interval, and *VerifyError is returned at last.
+// The current brightness is read instead if the device has no actual brightness.
+func (d *Device) EnableVerify(retries int, interval time.Duration) {
+	if retries < 0 {
+		retries = 0
+	}
+	d.verify = true
+	d.retries = retries
+	d.interval = interval
+}
+
+// DisableVerify disables EnableVerify.
+func (d *Device) DisableVerify() { d.verify = false }
+
+// all writes of Device pass through here
+func (d *Device) write(want uint) error {
+	if err := d.internal.Set(want); err != nil {
+		return err
+	}
+	if !d.verify {
+		return nil
+	}
+	for i := 0; ; i++ {
+		if d.interval > 0 {
+			time.Sleep(d.interval)
+		}
+		actual, err := d.Actual()
+		if err == ErrNotSupported {
+			actual, err = d.internal.Current()
+		}
+		if err != nil {
+			return err
+		}
+		if actual == want {
+			return nil
+		}
+		if i >= d.retries {
+			return &VerifyError{Name: d.Name(), Want: want, Actual: actual}
+		}
+		if err := d.internal.Set(want); err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,129 @@
+package brightness
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// Source is the origin of the Change.
+type Source int
+
+const (
+	// written by the software, e.g. akari or the desktop
+	SourceSoftware Source = iota
+
+	// changed by the hardware itself, e.g. Fn+Space on ThinkPads
+	SourceHardware
+)
+
+func (s Source) String() string {
+	switch s {
+	case SourceSoftware:
+		return "software"
+	case SourceHardware:
+		return "hardware"
+	default:
+		return "unknown"
+	}
+}
+
+// Change is the change of the brightness reported by Watch.
+type Change struct {
+	Old, New uint
+	Source   Source
+	Time     time.Time
+}
+
+// Controller may implement Notifier to notify that the brightness may be changed,
+// e.g. by inotify. The channel must be closed when ctx is done.
+type Notifier interface {
+	Notify(ctx context.Context) (<-chan Source, error)
+}
+
+// Controller may implement HardwareChangeReader to report the brightness
+// that the hardware changed by itself.
+type HardwareChangeReader interface {
+	HardwareChanged() (uint, error)
+}
+
+// ErrNoHardwareChange is returned by HardwareChanged
+// when the hardware has not changed the brightness yet.
+var ErrNoHardwareChange = errors.New("brightness has not been changed by the hardware")
+
+// HardwareChanged returns the brightness last changed by the hardware itself.
+// return ErrNotSupported if the device does not report it.
+func (d *Device) HardwareChanged() (uint, error) {
+	if h, ok := d.internal.(HardwareChangeReader); ok {
+		return h.HardwareChanged()
+	}
+	return 0, ErrNotSupported
+}
+
+// WatchInterval is the interval of polling by Watch.
+// The polling is always enabled since the changes by the firmware may not be notified.
+var WatchInterval = 500 * time.Millisecond
+
+// Watch reports the changes of the brightness by others, e.g. firmware hotkeys or other tools,
+// until ctx is done. The channel is closed when ctx is done.
+// The brightness is checked when the Notifier notified and at every WatchInterval.
+// The Change is SourceHardware if the Notifier reported it or HardwareChanged is updated.
+func (d *Device) Watch(ctx context.Context) <-chan Change {
+	ch := make(chan Change)
+	var notify <-chan Source
+	if n, ok := d.internal.(Notifier); ok {
+		// fallback to polling only if failed
+		notify, _ = n.Notify(ctx)
+	}
+	// the changes after return are reported
+	last, err := d.internal.Current()
+	known := err == nil
+	hw, hwErr := d.HardwareChanged()
+	go func() {
+		defer close(ch)
+		ticker := time.NewTicker(WatchInterval)
+		defer ticker.Stop()
+		// the hardware may be notified before the brightness is updated,
+		// then keep it until the next polling
+		pending := false
+		for {
+			polling := false
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				polling = true
+			case s, ok := <-notify:
+				if !ok {
+					notify = nil
+					continue
+				}
+				pending = pending || s == SourceHardware
+			}
+			if h, err := d.HardwareChanged(); err == nil && (hwErr != nil || h != hw) {
+				pending = true
+				hw, hwErr = h, nil
+			}
+			current, err := d.internal.Current()
+			if err != nil {
+				continue
+			}
+			if known && current != last {
+				source := SourceSoftware
+				if pending {
+					source = SourceHardware
+				}
+				pending = false
+				select {
+				case ch <- Change{Old: last, New: current, Source: source, Time: time.Now()}:
+				case <-ctx.Done():
+					return
+				}
+			} else if polling {
+				pending = false
+			}
+			last, known = current, true
+		}
+	}()
+	return ch
+}